@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/h4ckm03d/simpleplan/codec"
+	"github.com/h4ckm03d/simpleplan/model"
+	"github.com/h4ckm03d/simpleplan/router"
+)
+
+// logLevel filters the JSON log lines, a line is written if its level is at
+// least the current one.
+type logLevel int32
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l logLevel) String() string {
+	if l < levelDebug || l > levelError {
+		return fmt.Sprintf("level(%d)", int32(l))
+	}
+
+	return levelNames[l]
+}
+
+func parseLogLevel(s string) (logLevel, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return logLevel(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown log level %q (%s)", s, strings.Join(levelNames, "|"))
+}
+
+// currentLevel is the level of the written log lines, changed at runtime from
+// the admin listener.
+var currentLevel = int32(levelInfo)
+
+func setLogLevel(l logLevel) {
+	atomic.StoreInt32(&currentLevel, int32(l))
+}
+
+func getLogLevel() logLevel {
+	return logLevel(atomic.LoadInt32(&currentLevel))
+}
+
+// logEnabled reports if lines of level l are written.
+func logEnabled(l logLevel) bool {
+	return l >= getLogLevel()
+}
+
+// levelFlag is the flag.Value of the log level.
+type levelFlag struct{}
+
+func (levelFlag) String() string {
+	return getLogLevel().String()
+}
+
+func (levelFlag) Set(s string) error {
+	l, err := parseLogLevel(s)
+	if err != nil {
+		return err
+	}
+
+	setLogLevel(l)
+	return nil
+}
+
+func init() {
+	expvar.Publish("runtime", expvar.Func(runtimeStats))
+}
+
+type runtimeGC struct {
+	Runs       uint32    `json:"runs"`
+	PauseTotal string    `json:"pause_total"`
+	LastPause  string    `json:"last_pause"`
+	Last       time.Time `json:"last"`
+	CPUPercent float64   `json:"cpu_percent"`
+}
+
+type runtimeMemory struct {
+	HeapAlloc   uint64 `json:"heap_alloc"`
+	HeapInuse   uint64 `json:"heap_inuse"`
+	HeapObjects uint64 `json:"heap_objects"`
+	StackInuse  uint64 `json:"stack_inuse"`
+	Sys         uint64 `json:"sys"`
+}
+
+type runtimeInfo struct {
+	Goroutines int           `json:"goroutines"`
+	CPUs       int           `json:"cpus"`
+	Version    string        `json:"go_version"`
+	GC         runtimeGC     `json:"gc"`
+	Memory     runtimeMemory `json:"memory"`
+}
+
+// runtimeStats sums up the goroutines, GC and memory of the process, the full
+// runtime.MemStats are published as "memstats" by expvar.
+func runtimeStats() interface{} {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	info := runtimeInfo{
+		Goroutines: runtime.NumGoroutine(),
+		CPUs:       runtime.NumCPU(),
+		Version:    runtime.Version(),
+		GC: runtimeGC{
+			Runs:       m.NumGC,
+			PauseTotal: time.Duration(m.PauseTotalNs).String(),
+			LastPause:  time.Duration(m.PauseNs[(m.NumGC+255)%256]).String(),
+			CPUPercent: m.GCCPUFraction * 100,
+		},
+		Memory: runtimeMemory{
+			HeapAlloc:   m.HeapAlloc,
+			HeapInuse:   m.HeapInuse,
+			HeapObjects: m.HeapObjects,
+			StackInuse:  m.StackInuse,
+			Sys:         m.Sys,
+		},
+	}
+	if m.LastGC > 0 {
+		info.GC.Last = time.Unix(0, int64(m.LastGC)).UTC()
+	}
+
+	return info
+}
+
+// expvarHandler serves the expvar variables like expvar.Handler, without the
+// command line: it may hold the values of secret flags, redacted by /debug/config.
+func expvarHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	fmt.Fprintf(w, "{\n")
+	first := true
+	expvar.Do(func(kv expvar.KeyValue) {
+		if kv.Key == "cmdline" {
+			return
+		}
+		if !first {
+			fmt.Fprintf(w, ",\n")
+		}
+		first = false
+		fmt.Fprintf(w, "%q: %s", kv.Key, kv.Value)
+	})
+	fmt.Fprintf(w, "\n}\n")
+}
+
+// secretFlags are the parts of flag names whose values are redacted.
+var secretFlags = []string{"key", "secret", "token", "password", "dsn"}
+
+// effectiveConfig returns the flag values of fs, defaults included, with the
+// values of secret flags redacted.
+func effectiveConfig(fs *flag.FlagSet) map[string]string {
+	cfg := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		for _, s := range secretFlags {
+			if value != "" && strings.Contains(strings.ToLower(f.Name), s) {
+				value = "[REDACTED]"
+				break
+			}
+		}
+		cfg[f.Name] = value
+	})
+
+	return cfg
+}
+
+type logLevelBody struct {
+	Level string `json:"level"`
+}
+
+type routeEntry struct {
+	Method     string   `json:"method,omitempty"`
+	Pattern    string   `json:"pattern"`
+	Name       string   `json:"name,omitempty"`
+	Middleware []string `json:"middleware"`
+}
+
+// adminHandler serves the operator endpoints, never exposed on the public listeners:
+// profiling, runtime stats, the route table of d, the effective configuration read
+// from fs and the log level.
+func (app *application) adminHandler(d router.Dispatcher, fs *flag.FlagSet) http.Handler {
+	r := router.New("/debug")
+
+	// pprof answers the profile named in the path from its index
+	r.Group("/pprof", func(r router.Router) {
+		r.Add("/", http.HandlerFunc(pprof.Index)).Name("admin.pprof")
+		r.Add("/profile", http.HandlerFunc(pprof.Profile))
+		r.Add("/symbol", http.HandlerFunc(pprof.Symbol))
+		r.Add("/trace", http.HandlerFunc(pprof.Trace))
+		r.Add("/:profile", http.HandlerFunc(pprof.Index))
+	})
+
+	r.Handle(http.MethodGet, "/vars", http.HandlerFunc(expvarHandler)).Name("admin.vars")
+
+	r.Group("/", func(r router.Router) {
+		r.Wrap(restMiddleware)
+
+		r.Handle(http.MethodGet, "/routes", app.errHandler(func(w http.ResponseWriter, r *http.Request) error {
+			routes := make([]routeEntry, 0)
+			for _, rt := range d.Routes() {
+				routes = append(routes, routeEntry(rt))
+			}
+			sort.SliceStable(routes, func(i, j int) bool { return routes[i].Pattern < routes[j].Pattern })
+
+			return json.NewEncoder(w).Encode(routes)
+		})).Name("admin.routes")
+
+		r.Handle(http.MethodGet, "/config", app.errHandler(func(w http.ResponseWriter, r *http.Request) error {
+			return json.NewEncoder(w).Encode(effectiveConfig(fs))
+		})).Name("admin.config")
+
+		r.Handle(http.MethodGet, "/log-level", app.errHandler(func(w http.ResponseWriter, r *http.Request) error {
+			return json.NewEncoder(w).Encode(logLevelBody{Level: getLogLevel().String()})
+		})).Name("admin.log-level")
+
+		r.Handle(http.MethodPut, "/log-level", app.errHandler(func(w http.ResponseWriter, r *http.Request) error {
+			var body logLevelBody
+			defer dclose(r.Body)
+			if err := codec.DecodeStrict(r.Body, &body); err != nil {
+				return err
+			}
+
+			l, err := parseLogLevel(body.Level)
+			if err != nil {
+				return err
+			}
+
+			setLogLevel(l)
+			return json.NewEncoder(w).Encode(logLevelBody{Level: l.String()})
+		}))
+	})
+
+	admin := router.Build(r)
+	admin.NotFound(app.errorHandler(model.ErrNotFound))
+	admin.MethodNotAllowed(app.errorHandler(model.ErrMethodNotAllowed))
+	return admin
+}
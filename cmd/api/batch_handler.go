@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/h4ckm03d/simpleplan/model"
+)
+
+// maxBatchSize limits the number of operations accepted in a single batch request.
+const maxBatchSize = 1000
+
+type batchRequest struct {
+	// Atomic makes the batch all-or-nothing, otherwise every operation is
+	// applied on its own (best-effort).
+	Atomic     bool                   `json:"atomic" xml:"atomic"`
+	Operations []model.BatchOperation `json:"operations" xml:"operations>operation"`
+}
+
+type batchItem struct {
+	Index  int         `json:"index" xml:"index"`
+	Op     string      `json:"op" xml:"op"`
+	Status int         `json:"status" xml:"status"`
+	Plan   *model.Plan `json:"plan,omitempty" xml:"plan,omitempty"`
+	Error  string      `json:"error,omitempty" xml:"error,omitempty"`
+}
+
+type batchResponse struct {
+	Results []batchItem `json:"results" xml:"results>result"`
+}
+
+// batchPlanHandler applies mixed create, update and delete operations and reports
+// a status per operation. A rolled back atomic batch answers 422, a best-effort
+// batch with failed operations 207.
+func (app *application) batchPlanHandler(w http.ResponseWriter, r *http.Request) error {
+	var req batchRequest
+	defer dclose(r.Body)
+	if err := app.decode(r, &req); err != nil {
+		return err
+	}
+
+	if len(req.Operations) == 0 {
+		return errors.New("empty batch")
+	}
+	if len(req.Operations) > maxBatchSize {
+		return fmt.Errorf("batch too large, max %d operations", maxBatchSize)
+	}
+
+	results, err := app.PlanRepo.Batch(req.Operations, req.Atomic)
+	if err != nil && !errors.Is(err, model.ErrBatchAborted) {
+		return err
+	}
+
+	res := batchResponse{Results: make([]batchItem, len(results))}
+	for i, result := range results {
+		res.Results[i] = batchItem{
+			Index:  result.Index,
+			Op:     string(result.Op),
+			Status: batchStatus(result),
+			Plan:   result.Plan,
+		}
+		if result.Err != nil {
+			res.Results[i].Error = result.Err.Error()
+		}
+	}
+
+	status := http.StatusOK
+	if err != nil {
+		status = http.StatusUnprocessableEntity
+	} else if failed(results) {
+		status = http.StatusMultiStatus
+	}
+
+	return app.respond(w, r, status, res)
+}
+
+// failed reports if any operation of the batch failed.
+func failed(results []model.BatchResult) bool {
+	for _, result := range results {
+		if result.Err != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// batchStatus maps a batch result to the status the single item endpoint would answer.
+func batchStatus(result model.BatchResult) int {
+	switch {
+	case errors.Is(result.Err, model.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(result.Err, model.ErrBatchAborted):
+		return http.StatusFailedDependency
+	case result.Err != nil:
+		return http.StatusBadRequest
+	case result.Op == model.BatchCreate:
+		return http.StatusCreated
+	case result.Op == model.BatchDelete:
+		return http.StatusNoContent
+	}
+
+	return http.StatusOK
+}
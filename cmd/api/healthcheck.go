@@ -1,16 +1,21 @@
 package main
 
 import (
-	"encoding/json"
 	"net/http"
 )
 
+type healthResponse struct {
+	Env     string `json:"env" xml:"env"`
+	Status  string `json:"status" xml:"status"`
+	Version string `json:"version" xml:"version"`
+}
+
 // Declare a handler which writes a plain-text response with information about the
 // application status, operating environment and version.
 func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Request) error {
-	return json.NewEncoder(w).Encode(map[string]string{
-		"status":  "ok",
-		"env":     app.config.env,
-		"version": version,
+	return app.respond(w, r, http.StatusOK, healthResponse{
+		Env:     app.config.env,
+		Status:  "ok",
+		Version: version,
 	})
 }
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/h4ckm03d/simpleplan/model"
+	"github.com/h4ckm03d/simpleplan/router"
+)
+
+const (
+	idempotencyHeader = "Idempotency-Key"
+	replayedHeader    = "Idempotent-Replayed"
+	maxKeyLength      = 255
+
+	// maxIdempotentBody is the largest body buffered per key, whatever the route limit.
+	maxIdempotentBody = 1 << 20
+)
+
+// storedHeaders are the response headers replayed with the stored body. Headers of
+// the request at hand, such as X-Request-Id, or of the body as sent, such as
+// Content-Encoding, are set again by the middleware of the retry.
+var storedHeaders = []string{"Content-Type", "Content-Language", "Content-Location", "Location", "ETag", "Last-Modified"}
+
+// idempotent replays the stored response of a POST request repeated with the same
+// Idempotency-Key header. Requests without the header are passed through.
+func (app *application) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyHeader)
+		if app.idempotency == nil || key == "" || r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > maxKeyLength {
+			writeError(w, r, http.StatusBadRequest, errors.New("idempotency key too long"))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBody))
+		dclose(r.Body)
+		if err != nil {
+			// MaxBytesReader fails once it has returned the whole allowance
+			if len(body) == maxIdempotentBody {
+				err = router.ErrBodyTooLarge
+			}
+			writeError(w, r, errorStatus(err), err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		stored, err := app.idempotency.Begin(r.Context(), key, requestHash(r, body))
+		switch {
+		case errors.Is(err, model.ErrKeyReused):
+			writeError(w, r, http.StatusUnprocessableEntity, err)
+			return
+		case err != nil:
+			writeError(w, r, http.StatusServiceUnavailable, err)
+			return
+		case stored != nil:
+			replay(w, stored)
+			return
+		}
+
+		// The key stays claimed until the handler returns. Its response is stored even
+		// if it couldn't be sent, e.g. after the timeout answered, as the plan may be
+		// created: a retry replays it instead of creating another one.
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			// Server errors and panics aren't stored so the client can retry
+			if p := recover(); p != nil {
+				app.idempotency.Abort(key)
+				panic(p)
+			}
+			if rec.status >= http.StatusInternalServerError {
+				app.idempotency.Abort(key)
+				return
+			}
+			app.idempotency.Complete(key, &model.IdempotentResponse{
+				Status: rec.status,
+				Header: representationHeader(w.Header()),
+				Body:   rec.body.Bytes(),
+			})
+		}()
+
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// requestHash identifies a request by method, path and body.
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// representationHeader returns the stored headers of h.
+func representationHeader(h http.Header) http.Header {
+	stored := make(http.Header)
+	for _, k := range storedHeaders {
+		if v := h.Values(k); len(v) > 0 {
+			stored[k] = append([]string(nil), v...)
+		}
+	}
+
+	return stored
+}
+
+func replay(w http.ResponseWriter, res *model.IdempotentResponse) {
+	for k, v := range res.Header {
+		w.Header()[k] = append([]string(nil), v...)
+	}
+	w.Header().Set(replayedHeader, "true")
+	w.WriteHeader(res.Status)
+	_, _ = w.Write(res.Body)
+}
+
+// responseRecorder passes a response through while keeping a copy of it, the
+// whole response even when writing it fails.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.wroteHeader = true
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// listenFDsStart is the first file descriptor passed by socket activation.
+var listenFDsStart = 3
+
+// inheritedFDs records the passed file descriptors already listened on. Their
+// files are closed once the listener is created, so they can't be taken twice,
+// e.g. by "fd:" and "fd:name".
+var inheritedFDs = make(map[int]bool)
+
+// activation holds the sockets passed by socket activation, nil until read.
+var activation *passedSockets
+
+type passedSockets struct {
+	n     int
+	names []string
+}
+
+// listenAddrs lists the addresses to listen on, a flag.Value set once per address.
+type listenAddrs []string
+
+func (a *listenAddrs) String() string {
+	if a == nil {
+		return ""
+	}
+
+	return strings.Join(*a, ",")
+}
+
+func (a *listenAddrs) Set(s string) error {
+	*a = append(*a, s)
+	return nil
+}
+
+// listen opens the listeners of addr: "unix:/path.sock" for a Unix socket, "fd:"
+// for every socket passed with LISTEN_FDS, "fd:name" for the ones named so in
+// LISTEN_FDNAMES, a TCP address otherwise. A passed socket is listened on once.
+func listen(addr string) ([]net.Listener, error) {
+	switch {
+	case strings.HasPrefix(addr, "unix:"):
+		l, err := listenUnix(strings.TrimPrefix(addr, "unix:"))
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{l}, nil
+	case strings.HasPrefix(addr, "fd:"):
+		return inheritedListeners(strings.TrimPrefix(addr, "fd:"))
+	default:
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{l}, nil
+	}
+}
+
+// listenUnix listens on a Unix socket, replacing the socket left by a previous run.
+func listenUnix(path string) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return net.Listen("unix", path)
+}
+
+// readActivation reads the sockets passed by socket activation once. Like
+// sd_listen_fds(1), it removes their variables from the environment so child
+// processes don't take them for their own.
+func readActivation() (*passedSockets, error) {
+	if activation != nil {
+		return activation, nil
+	}
+
+	pid, pidErr := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	n, nErr := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	for _, key := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		_ = os.Unsetenv(key)
+	}
+
+	if pidErr != nil || pid != os.Getpid() {
+		return nil, errors.New("fd: no socket passed to this process (LISTEN_PID)")
+	}
+	if nErr != nil || n <= 0 {
+		return nil, errors.New("fd: no socket passed to this process (LISTEN_FDS)")
+	}
+
+	activation = &passedSockets{n: n, names: names}
+	return activation, nil
+}
+
+// inheritedListeners returns the sockets passed by socket activation, only the
+// ones named name unless empty.
+func inheritedListeners(name string) ([]net.Listener, error) {
+	passed, err := readActivation()
+	if err != nil {
+		return nil, err
+	}
+
+	var listeners []net.Listener
+	for i := 0; i < passed.n; i++ {
+		if name != "" && (i >= len(passed.names) || passed.names[i] != name) {
+			continue
+		}
+
+		fd := listenFDsStart + i
+		if inheritedFDs[fd] {
+			closeListeners(listeners)
+			return nil, fmt.Errorf("fd %d: already listened on", fd)
+		}
+
+		f := os.NewFile(uintptr(fd), fmt.Sprintf("fd:%d", fd))
+		l, err := net.FileListener(f)
+		_ = f.Close()
+		if err != nil {
+			closeListeners(listeners)
+			return nil, fmt.Errorf("fd %d: %w", fd, err)
+		}
+		inheritedFDs[fd] = true
+		listeners = append(listeners, l)
+	}
+
+	if len(listeners) == 0 {
+		return nil, fmt.Errorf("fd: no socket named %q", name)
+	}
+
+	return listeners, nil
+}
+
+func closeListeners(listeners []net.Listener) {
+	for _, l := range listeners {
+		_ = l.Close()
+	}
+}
+
+// withH2C lets the clients of srv speak HTTP/2 without TLS, with prior knowledge
+// or by upgrade. The HTTP/2 server is registered with srv, so shutting srv down
+// sends GOAWAY on h2c connections too.
+func withH2C(srv *http.Server) error {
+	// ConfigureServer sets up a TLS configuration, srv serves TLS only if it had one
+	tlsConfig := srv.TLSConfig
+	h2s := &http2.Server{}
+	if err := http2.ConfigureServer(srv, h2s); err != nil {
+		return err
+	}
+	srv.TLSConfig = tlsConfig
+
+	srv.Handler = &h2cHandler{Handler: h2c.NewHandler(srv.Handler, h2s)}
+	return nil
+}
+
+// h2cHandler serves h2c connections, hijacked from the server so not waited for
+// on shutdown. It counts them for serve to drain.
+type h2cHandler struct {
+	http.Handler
+	conns sync.WaitGroup
+}
+
+func (h *h2cHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.conns.Add(1)
+	defer h.conns.Done()
+
+	// Returns once the connection is closed for h2c ones
+	h.Handler.ServeHTTP(w, r)
+}
+
+// drain waits for the running requests and h2c connections until ctx is done.
+func (h *h2cHandler) drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		h.conns.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// serve serves srv on every listener until ctx is done or one of them fails,
+// then shuts the server down, waiting up to grace for the running requests, h2c
+// streams included. With a TLS configuration, every listener serves TLS, Unix sockets included.
+func serve(ctx context.Context, srv *http.Server, listeners []net.Listener, grace time.Duration) error {
+	// Decided once, serving sets up a TLS configuration for HTTP/2 if there's none
+	useTLS := srv.TLSConfig != nil
+
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			if useTLS {
+				errs <- srv.ServeTLS(l, "", "")
+				return
+			}
+			errs <- srv.Serve(l)
+		}(l)
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-errs:
+	}
+
+	shutdown, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	serr := srv.Shutdown(shutdown)
+	// The h2c connections got GOAWAY, they end with their last stream
+	if h, ok := srv.Handler.(*h2cHandler); ok && serr == nil {
+		serr = h.drain(shutdown)
+	}
+	if err == nil {
+		err = serr
+	}
+
+	return err
+}
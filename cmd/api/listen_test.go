@@ -0,0 +1,164 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/h4ckm03d/simpleplan/repo"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+)
+
+func TestListeners(t *testing.T) {
+	app := &application{config: config{env: "test", repanic: true}, PlanRepo: repo.NewPlanRepo(&testTime{})}
+	srv := &http.Server{Handler: app.handler()}
+	assert.NoError(t, withH2C(srv))
+	assert.Nil(t, srv.TLSConfig)
+
+	// A socket passed by socket activation, duplicated to be owned by the listener
+	activated, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	f, err := activated.(*net.TCPListener).File()
+	assert.NoError(t, err)
+	fd, err := syscall.Dup(int(f.Fd()))
+	assert.NoError(t, err)
+	f.Close()
+	defer activated.Close()
+
+	defer func(start int) { listenFDsStart, activation = start, nil }(listenFDsStart)
+	listenFDsStart, activation = fd, nil
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_FDNAMES", "http")
+
+	sock := filepath.Join(t.TempDir(), "api.sock")
+	assert.NoError(t, os.WriteFile(sock, nil, 0o600))
+	_, err = listen("unix:" + sock)
+	assert.Error(t, err, "regular files aren't replaced")
+	assert.NoError(t, os.Remove(sock))
+
+	var listeners []net.Listener
+	for _, addr := range []string{"127.0.0.1:0", "unix:" + sock, "fd:http"} {
+		ls, err := listen(addr)
+		assert.NoError(t, err, addr)
+		listeners = append(listeners, ls...)
+	}
+	assert.Len(t, listeners, 3)
+
+	_, err = listen("fd:https")
+	assert.Error(t, err)
+
+	// Child processes don't inherit the passed sockets
+	for _, key := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		_, ok := os.LookupEnv(key)
+		assert.False(t, ok, key)
+	}
+
+	// The passed socket was closed once listened on
+	_, err = listen("fd:")
+	assert.EqualError(t, err, fmt.Sprintf("fd %d: already listened on", fd))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- serve(ctx, srv, listeners, time.Second) }()
+
+	tcp := listeners[0].Addr().String()
+	clients := map[string]*http.Client{
+		"tcp": {},
+		"unix": {Transport: &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		}}},
+		"fd": {Transport: &http.Transport{DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, activated.Addr().String())
+		}}},
+		"h2c": {Transport: &http2.Transport{AllowHTTP: true, DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		}}},
+	}
+	for name, client := range clients {
+		res, err := client.Get(fmt.Sprintf("http://%s/v1/health", tcp))
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode, name)
+		if name == "h2c" {
+			assert.Equal(t, 2, res.ProtoMajor)
+		}
+	}
+
+	// All listeners stop together, the socket file is removed. Idle h2c connections
+	// would only be closed a second after GOAWAY.
+	for _, client := range clients {
+		client.CloseIdleConnections()
+	}
+	cancel()
+	assert.NoError(t, <-done)
+	_, err = os.Stat(sock)
+	assert.True(t, os.IsNotExist(err))
+	_, err = net.Dial("tcp", tcp)
+	assert.Error(t, err)
+}
+
+func TestH2CShutdown(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		_, _ = io.WriteString(w, "done")
+	})}
+	assert.NoError(t, withH2C(srv))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() { served <- serve(ctx, srv, []net.Listener{l}, 5*time.Second) }()
+
+	// Prior knowledge, no upgrade
+	client := &http.Client{Transport: &http2.Transport{AllowHTTP: true, DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	}}}
+	type result struct {
+		body string
+		err  error
+	}
+	got := make(chan result)
+	go func() {
+		res, err := client.Get("http://" + l.Addr().String() + "/")
+		if err != nil {
+			got <- result{err: err}
+			return
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		got <- result{body: string(body), err: err}
+	}()
+	<-started
+
+	// The running stream holds the shutdown until it's answered
+	cancel()
+	select {
+	case err := <-served:
+		t.Fatalf("served before the h2c stream ended: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	res := <-got
+	assert.NoError(t, res.err)
+	assert.Equal(t, "done", res.body)
+	assert.NoError(t, <-served)
+}
@@ -1,16 +1,23 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/h4ckm03d/simpleplan/codec"
+	"github.com/h4ckm03d/simpleplan/model"
 	"github.com/h4ckm03d/simpleplan/port"
 	"github.com/h4ckm03d/simpleplan/repo"
-	"github.com/h4ckm03d/simpleplan/router"
 )
 
 // Declare a string containing the application version number. Later in the book we'll
@@ -24,28 +31,93 @@ const version = "1.0.0"
 // application (development, staging, production, etc.). We will read in these
 // configuration settings from command-line flags when the application starts.
 type config struct {
-	port int
-	env  string
+	port           int
+	env            string
+	idempotencyTTL time.Duration
+	debug          bool
+	deprecations   deprecations
+	cors           corsConfig
+	compressMin    int
+	maxBody        int64
+	handlerTimeout time.Duration
+	readTimeout    time.Duration
+	writeTimeout   time.Duration
+	tls            tlsConfig
+	listen         listenAddrs
+	h2c            bool
+	adminListen    string
+	transitions    model.StateMachine
+
+	// Let panics of handlers through once logged, for tests
+	repanic bool
 }
 
 // Define an application struct to hold the dependencies for our HTTP handlers, helpers,
 // and middleware. At the moment this only contains a copy of the config struct and a
 // logger, but it will grow to include a lot more as our build progresses.
 type application struct {
-	config config
-	logger *log.Logger
+	config      config
+	logger      *log.Logger
+	idempotency port.IdempotencyStore
+	codecs      *codec.Registry
 	port.PlanRepo
 }
 
+// log returns the application logger, the standard logger if unset.
+func (app *application) log() *log.Logger {
+	if app.logger == nil {
+		return log.Default()
+	}
+
+	return app.logger
+}
+
+// stateMachine returns the configured plan status transitions, the default ones if unset.
+func (app *application) stateMachine() model.StateMachine {
+	if app.config.transitions == nil {
+		return model.DefaultStateMachine()
+	}
+
+	return app.config.transitions
+}
+
 func main() {
 	// Declare an instance of the config struct.
-	var cfg config
+	cfg := config{deprecations: deprecations{}}
 
 	// Read the value of the port and env command-line flags into the config struct. We
 	// default to using the port number 4000 and the environment "development" if no
 	// corresponding flags are provided.
 	flag.IntVar(&cfg.port, "port", 4000, "API server port")
 	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
+	flag.DurationVar(&cfg.idempotencyTTL, "idempotency-ttl", 24*time.Hour, "How long responses are kept for Idempotency-Key replays")
+	flag.Var(cfg.deprecations, "deprecate", "Deprecated API version as version:date[:sunset], e.g. v1:2026-10-01:2027-04-01 (repeatable)")
+	flag.Func("cors-origins", "Comma separated origins allowed to call the API, e.g. https://*.example.com", func(s string) error {
+		cfg.cors.origins = append(cfg.cors.origins, strings.Split(s, ",")...)
+		return nil
+	})
+	flag.DurationVar(&cfg.cors.maxAge, "cors-max-age", 10*time.Minute, "How long browsers may cache CORS preflight responses")
+	flag.Int64Var(&cfg.maxBody, "max-body", 1<<20, "Largest request body in bytes, 0 for no limit")
+	flag.DurationVar(&cfg.handlerTimeout, "handler-timeout", 10*time.Second, "How long plan handlers may take to answer, 0 for no timeout")
+	flag.DurationVar(&cfg.readTimeout, "read-timeout", 10*time.Second, "How long clients may take to send a request, import bodies included, 0 for no timeout")
+	flag.DurationVar(&cfg.writeTimeout, "write-timeout", 30*time.Second, "How long a response may take to be written, exports included, 0 for no timeout")
+	flag.IntVar(&cfg.compressMin, "compress-min-size", 1024, "Smallest response body compressed in bytes, 0 to disable compression")
+	flag.StringVar(&cfg.tls.certFile, "tls-cert", "", "TLS certificate file, TLS is off without it")
+	flag.StringVar(&cfg.tls.keyFile, "tls-key", "", "TLS private key file")
+	flag.StringVar(&cfg.tls.clientCAFile, "tls-client-ca", "", "CA bundle verifying client certificates, turns mTLS on")
+	flag.StringVar(&cfg.tls.minVersion, "tls-min-version", "1.2", "Minimum TLS version (1.0|1.1|1.2|1.3)")
+	flag.StringVar(&cfg.tls.ciphers, "tls-ciphers", "", "Comma separated TLS 1.2 cipher suites, the crypto/tls defaults if empty")
+	flag.DurationVar(&cfg.tls.reloadInterval, "tls-reload-interval", 10*time.Second, "How often the certificate files are checked for changes")
+	flag.Var(&cfg.listen, "listen", "Address to listen on, host:port, unix:/path.sock or fd:[name] for socket activation (repeatable, default :port), all with TLS when set")
+	flag.BoolVar(&cfg.h2c, "h2c", false, "Accept HTTP/2 without TLS")
+	flag.StringVar(&cfg.adminListen, "admin-listen", "", "Address of the admin listener (pprof, stats, routes, config, log level), off if empty, e.g. 127.0.0.1:4001")
+	flag.Var(levelFlag{}, "log-level", "Level of the request logs (debug|info|warn|error)")
+	flag.Func("transitions", "Allowed plan status transitions as from:to,to;from:to, e.g. draft:active;active:done (default "+model.DefaultStateMachine().String()+")", func(s string) error {
+		sm, err := model.ParseStateMachine(s)
+		cfg.transitions = sm
+		return err
+	})
+	flag.BoolVar(&cfg.debug, "debug", false, "Print the route table at startup")
 	flag.Parse()
 
 	// Initialize a new logger which writes messages to the standard out stream,
@@ -55,24 +127,94 @@ func main() {
 	// Declare an instance of the application struct, containing the config struct and
 	// the logger.
 	app := &application{
-		config:   cfg,
-		logger:   logger,
-		PlanRepo: repo.NewPlanRepo(nil),
+		config:      cfg,
+		logger:      logger,
+		idempotency: repo.NewIdempotencyRepo(nil, cfg.idempotencyTTL),
+		PlanRepo:    repo.NewPlanRepo(nil),
 	}
 
-	// Declare a HTTP server with some sensible timeout settings, which listens on the
-	// port provided in the config struct and uses the servemux we created above as the
-	// handler.
+	// Print the route table in debug mode.
+	handler := app.handler()
+	if cfg.debug {
+		if err := printRoutes(logger.Writer(), handler.Routes()); err != nil {
+			logger.Fatal(err)
+		}
+	}
+
+	// Declare a HTTP server with the configured timeout settings, which uses the
+	// dispatcher we created above as the handler on every listener. Imports and
+	// exports stream within the read and write timeouts too.
 	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%d", cfg.port),
-		Handler:      router.Build(app.routes()),
+		Handler:      handler,
 		IdleTimeout:  time.Minute,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second,
+		ReadTimeout:  cfg.readTimeout,
+		WriteTimeout: cfg.writeTimeout,
+	}
+	// Stop on SIGINT or SIGTERM, letting the running requests end.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Serve over TLS, with certificates reloaded on change, when set.
+	if cfg.tls.enabled() {
+		store, err := newCertStore(cfg.tls.certFile, cfg.tls.keyFile, cfg.tls.clientCAFile, logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		if srv.TLSConfig, err = cfg.tls.serverTLS(store); err != nil {
+			logger.Fatal(err)
+		}
+		go store.watch(ctx, cfg.tls.reloadInterval)
+	}
+
+	// Accept HTTP/2 without TLS, once the TLS configuration is known.
+	if cfg.h2c {
+		if err := withH2C(srv); err != nil {
+			logger.Fatal(err)
+		}
+	}
+
+	// Listen on the port unless addresses are given.
+	addrs := cfg.listen
+	if len(addrs) == 0 {
+		addrs = listenAddrs{fmt.Sprintf(":%d", cfg.port)}
+	}
+
+	var listeners []net.Listener
+	for _, addr := range addrs {
+		ls, err := listen(addr)
+		if err != nil {
+			closeListeners(listeners)
+			logger.Fatalf("listen %s: %v", addr, err)
+		}
+		listeners = append(listeners, ls...)
+	}
+
+	// Start the admin server, sharing the lifecycle of the public one. Profiles take
+	// their time, so there's no write timeout.
+	if cfg.adminListen != "" {
+		ls, err := listen(cfg.adminListen)
+		if err != nil {
+			closeListeners(listeners)
+			logger.Fatalf("listen %s: %v", cfg.adminListen, err)
+		}
+
+		admin := &http.Server{Handler: app.adminHandler(handler, flag.CommandLine), ReadTimeout: 10 * time.Second}
+		for _, l := range ls {
+			logger.Printf("starting admin server on %s:%s", l.Addr().Network(), l.Addr())
+		}
+		go func() {
+			if err := serve(ctx, admin, ls, time.Second); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Printf("admin server: %v", err)
+			}
+		}()
 	}
 
 	// Start the HTTP server.
-	logger.Printf("starting %s server on %s", cfg.env, srv.Addr)
-	err := srv.ListenAndServe()
-	logger.Fatal(err)
+	for _, l := range listeners {
+		logger.Printf("starting %s server on %s:%s (tls %t, h2c %t)", cfg.env, l.Addr().Network(), l.Addr(), cfg.tls.enabled(), cfg.h2c)
+	}
+	if err := serve(ctx, srv, listeners, 30*time.Second); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Fatal(err)
+	}
+	logger.Printf("stopped %s server", cfg.env)
 }
@@ -2,15 +2,33 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
 	"log"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/h4ckm03d/simpleplan/codec"
 	"github.com/h4ckm03d/simpleplan/model"
 	"github.com/h4ckm03d/simpleplan/port"
 	"github.com/h4ckm03d/simpleplan/repo"
@@ -44,25 +62,35 @@ func Test_main(t *testing.T) {
 			status: http.StatusOK,
 		},
 		"GET /v1/plan/1": {
-			want:   model.Plan{ID: 1, Name: "Test plan", CreatedAt: customTime.Now(), UpdatedAt: customTime.Now()},
+			want:   model.Plan{ID: 1, Name: "Test plan", CreatedAt: customTime.Now(), UpdatedAt: customTime.Now(), Status: model.StatusDraft},
 			seed:   []*model.Plan{{Name: "Test plan"}},
 			status: http.StatusOK,
 		},
 		"GET /v1/plan": {
-			want:   []model.Plan{{ID: 1, Name: "Test plan", CreatedAt: customTime.Now(), UpdatedAt: customTime.Now()}},
+			want:   []model.Plan{{ID: 1, Name: "Test plan", CreatedAt: customTime.Now(), UpdatedAt: customTime.Now(), Status: model.StatusDraft}},
 			seed:   []*model.Plan{{Name: "Test plan"}},
 			status: http.StatusOK,
 		},
+		"GET /v1/plan?page=-1": {
+			want:   errorResponse{Error: "page: invalid value -1, pages start at 0"},
+			seed:   []*model.Plan{{Name: "Test plan"}},
+			status: http.StatusBadRequest,
+		},
+		"GET /v2/plan?page=-1": {
+			want:   errorResponse{Error: "page: invalid value -1, pages start at 0"},
+			seed:   []*model.Plan{{Name: "Test plan"}},
+			status: http.StatusBadRequest,
+		},
 		"POST /v1/plan": {
-			want:   model.Plan{ID: 2, Name: "Test plan 2", CreatedAt: customTime.Now(), UpdatedAt: customTime.Now()},
+			want:   model.Plan{ID: 2, Name: "Test plan 2", CreatedAt: customTime.Now(), UpdatedAt: customTime.Now(), Status: model.StatusDraft},
 			seed:   []*model.Plan{{Name: "Test plan"}},
 			data:   model.Plan{Name: "Test plan 2"},
 			status: http.StatusCreated,
 		},
 		"PUT /v1/plan/1": {
-			want:   model.Plan{ID: 1, Name: "Test plan 2", CreatedAt: customTime.Now(), UpdatedAt: customTime.Now()},
+			want:   model.Plan{ID: 1, Name: "Test plan 2", CreatedAt: customTime.Now(), UpdatedAt: customTime.Now(), Status: model.StatusDraft},
 			seed:   []*model.Plan{{Name: "Test plan"}},
-			data:   model.Plan{ID: 1, Name: "Test plan 2", CreatedAt: customTime.Now(), UpdatedAt: customTime.Now()},
+			data:   model.Plan{ID: 1, Name: "Test plan 2", CreatedAt: customTime.Now(), UpdatedAt: customTime.Now(), Status: model.StatusDraft},
 			status: http.StatusOK,
 		},
 		"POST /v1/plan empty": {
@@ -71,17 +99,94 @@ func Test_main(t *testing.T) {
 			data:   nil,
 			status: http.StatusBadRequest,
 		},
+		"POST /v1/plan:batch": {
+			want: batchResponse{Results: []batchItem{
+				{Index: 0, Op: "create", Status: http.StatusCreated, Plan: &model.Plan{ID: 2, Name: "Batch plan", CreatedAt: customTime.Now(), UpdatedAt: customTime.Now(), Status: model.StatusDraft}},
+				{Index: 1, Op: "update", Status: http.StatusOK, Plan: &model.Plan{ID: 1, Name: "Renamed", CreatedAt: customTime.Now(), UpdatedAt: customTime.Now(), Status: model.StatusDraft}},
+				{Index: 2, Op: "delete", Status: http.StatusNotFound, Error: model.ErrNotFound.Error()},
+			}},
+			seed: []*model.Plan{{Name: "Test plan"}},
+			data: batchRequest{Operations: []model.BatchOperation{
+				{Op: model.BatchCreate, Plan: &model.Plan{Name: "Batch plan"}},
+				{Op: model.BatchUpdate, ID: 1, Plan: &model.Plan{Name: "Renamed"}},
+				{Op: model.BatchDelete, ID: 100},
+			}},
+			status: http.StatusMultiStatus,
+		},
+		"POST /v1/plan:batch all failed": {
+			want: batchResponse{Results: []batchItem{
+				{Index: 0, Op: "delete", Status: http.StatusNotFound, Error: model.ErrNotFound.Error()},
+			}},
+			seed: []*model.Plan{{Name: "Test plan"}},
+			data: batchRequest{Operations: []model.BatchOperation{
+				{Op: model.BatchDelete, ID: 100},
+			}},
+			status: http.StatusMultiStatus,
+		},
+		"POST /v1/plan:batch succeeded": {
+			want: batchResponse{Results: []batchItem{
+				{Index: 0, Op: "delete", Status: http.StatusNoContent},
+			}},
+			seed: []*model.Plan{{Name: "Test plan"}},
+			data: batchRequest{Operations: []model.BatchOperation{
+				{Op: model.BatchDelete, ID: 1},
+			}},
+			status: http.StatusOK,
+		},
+		"POST /v1/plan:batch atomic": {
+			want: nil,
+			seed: []*model.Plan{{Name: "Test plan"}},
+			data: batchRequest{Atomic: true, Operations: []model.BatchOperation{
+				{Op: model.BatchDelete, ID: 1},
+				{Op: model.BatchDelete, ID: 100},
+			}},
+			status: http.StatusUnprocessableEntity,
+		},
+		"GET /v1/plan/export?format=jsonl": {
+			want:   model.Plan{ID: 1, Name: "Test plan", CreatedAt: customTime.Now(), UpdatedAt: customTime.Now(), Status: model.StatusDraft},
+			seed:   []*model.Plan{{Name: "Test plan"}},
+			status: http.StatusOK,
+		},
+		"GET /v1/plan/export?format=xml": {
+			want:   nil,
+			status: http.StatusBadRequest,
+		},
+		"POST /v1/plan/import": {
+			want:   importResponse{Imported: 1, Errors: []importError{}, Remapped: []importMapping{{SourceID: 7, ID: 2}}},
+			seed:   []*model.Plan{{Name: "Test plan"}},
+			data:   model.Plan{ID: 7, Name: "Imported"},
+			status: http.StatusOK,
+		},
+		"POST /v1/plan/import?preserve=true": {
+			want:   importResponse{Failed: 1, Errors: []importError{{Line: 1, Status: http.StatusConflict, Error: "id 1: already exists"}}},
+			seed:   []*model.Plan{{Name: "Test plan"}},
+			data:   model.Plan{ID: 1, Name: "Imported"},
+			status: http.StatusOK,
+		},
 		"DELETE /v1/plan/1": {
 			want:   nil,
 			seed:   []*model.Plan{{Name: "Test plan"}},
 			data:   nil,
 			status: http.StatusOK,
 		},
+		"GET /v1/plan/2": {
+			want:   errorResponse{Error: model.ErrNotFound.Error()},
+			seed:   []*model.Plan{{Name: "Test plan"}},
+			status: http.StatusNotFound,
+		},
+		"DELETE /v1/plan": {
+			want:   errorResponse{Error: model.ErrMethodNotAllowed.Error()},
+			status: http.StatusMethodNotAllowed,
+		},
+		"GET /v1/mbuh": {
+			want:   errorResponse{Error: model.ErrNotFound.Error()},
+			status: http.StatusNotFound,
+		},
 		"DELETE /v1/plan/mbuh": {
 			want:   nil,
 			seed:   []*model.Plan{{Name: "Test plan"}},
 			data:   nil,
-			status: http.StatusBadRequest,
+			status: http.StatusNotFound,
 		},
 	}
 
@@ -107,7 +212,7 @@ func Test_main(t *testing.T) {
 
 			// Create a new instance of the application.
 			app := &application{
-				config:   config{env: "test"},
+				config:   config{env: "test", repanic: true},
 				logger:   logger,
 				PlanRepo: repo.NewPlanRepo(customTime),
 			}
@@ -120,11 +225,879 @@ func Test_main(t *testing.T) {
 			err = json.NewEncoder(wantBuffer).Encode(tt.want)
 			assert.Nil(t, err)
 
-			router.Build(app.routes()).ServeHTTP(rr, req)
+			app.handler().ServeHTTP(rr, req)
 			assert.Equal(t, tt.status, rr.Result().StatusCode)
-			if tt.status == http.StatusOK && tt.want != nil {
+			if tt.want != nil {
 				assert.Equal(t, wantBuffer.String(), rr.Body.String())
 			}
 		})
 	}
 }
+
+func TestIdempotencyKey(t *testing.T) {
+	app := &application{
+		config:      config{env: "test", repanic: true},
+		logger:      log.New(os.Stdout, "", log.Ldate|log.Ltime),
+		idempotency: repo.NewIdempotencyRepo(&testTime{}, time.Hour),
+		PlanRepo:    repo.NewPlanRepo(&testTime{}),
+	}
+	handler := app.handler()
+
+	post := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/plan", strings.NewReader(body))
+		req.Header.Set("Idempotency-Key", key)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	first := post("abc", `{"name":"Once"}`)
+	assert.Equal(t, http.StatusCreated, first.Code)
+
+	// A retry keeps its own request ID
+	req := httptest.NewRequest("POST", "/v1/plan", strings.NewReader(`{"name":"Once"}`))
+	req.Header.Set("Idempotency-Key", "abc")
+	req.Header.Set("X-Request-Id", "second-req")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, "true", rr.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, []string{"second-req"}, rr.Header().Values("X-Request-Id"))
+	assert.Equal(t, first.Header().Get("Content-Type"), rr.Header().Get("Content-Type"))
+
+	// Concurrent retries all replay the first response
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			retry := post("abc", `{"name":"Once"}`)
+			assert.Equal(t, http.StatusCreated, retry.Code)
+			assert.Equal(t, first.Body.String(), retry.Body.String())
+			assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+		}()
+	}
+	wg.Wait()
+
+	plans, _ := app.PlanRepo.GetAll(10, 0)
+	assert.Len(t, plans, 1)
+
+	reused := post("abc", `{"name":"Twice"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, reused.Code)
+
+	other := post("def", `{"name":"Twice"}`)
+	assert.Equal(t, http.StatusCreated, other.Code)
+	assert.Empty(t, other.Header().Get("Idempotent-Replayed"))
+
+	// Bodies are buffered per key, so they're capped even without a route limit
+	large := post("ghi", `{"name":"`+strings.Repeat("a", maxIdempotentBody)+`"}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, large.Code)
+	assert.JSONEq(t, `{"error":"request body too large"}`, large.Body.String())
+}
+
+func TestRouteTable(t *testing.T) {
+	app := &application{config: config{env: "test"}, PlanRepo: repo.NewPlanRepo(nil)}
+	r := app.v1Routes()
+
+	out := new(bytes.Buffer)
+	assert.NoError(t, printRoutes(out, app.handler().Routes()))
+	assert.Contains(t, out.String(), "METHOD")
+	assert.Regexp(t, `DELETE +/v1/plan/:id<int> +plan.delete +\S*restMiddleware`, out.String())
+
+	url, err := r.URL("plan.get", map[string]string{"id": "12"})
+	assert.NoError(t, err)
+	assert.Equal(t, "/v1/plan/12", url)
+}
+
+func TestVersioning(t *testing.T) {
+	deps := deprecations{}
+	assert.NoError(t, deps.Set("v1:2026-10-01:2027-04-01"))
+	assert.Error(t, deps.Set("v9:2026-10-01"))
+	assert.Error(t, deps.Set("v1"))
+
+	app := &application{
+		config:   config{env: "test", deprecations: deps, repanic: true},
+		logger:   log.New(os.Stdout, "", log.Ldate|log.Ltime),
+		PlanRepo: repo.NewPlanRepo(&testTime{}),
+	}
+	handler := app.handler()
+
+	serve := func(method, target, accept, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// v2 creates, v1 reads the same repository
+	rr := serve("POST", "/v2/plan", "", `{"data":{"attributes":{"name":"Enveloped"}}}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, "application/vnd.simpleplan.v2+json", rr.Header().Get("Content-Type"))
+	assert.Empty(t, rr.Header().Get("Deprecation"))
+	assert.JSONEq(t, `{"data":{"id":1,"type":"plan","attributes":{"name":"Enveloped","description":"","status":"draft"},
+		"meta":{"created_at":"2006-01-02T15:04:05Z","updated_at":"2006-01-02T15:04:05Z"}}}`, rr.Body.String())
+
+	rr = serve("GET", "/v1/plan/1", "", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"name":"Enveloped"`)
+	assert.Equal(t, "@1790812800", rr.Header().Get("Deprecation"))
+	assert.Equal(t, "Thu, 01 Apr 2027 00:00:00 GMT", rr.Header().Get("Sunset"))
+	assert.Equal(t, `</v2>; rel="successor-version"`, rr.Header().Get("Link"))
+
+	// Unversioned paths are negotiated, v1 by default
+	rr = serve("GET", "/plan?limit=5", "application/vnd.simpleplan.v2+json", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "Accept", rr.Header().Get("Vary"))
+	assert.Contains(t, rr.Body.String(), `"meta":{"page":0,"limit":5,"count":1}`)
+
+	rr = serve("GET", "/plan/1", "application/json", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotEmpty(t, rr.Header().Get("Deprecation"))
+	assert.True(t, strings.HasPrefix(rr.Body.String(), `{"id":1,`))
+
+	// The path wins over the header
+	rr = serve("GET", "/v1/plan/1", "application/vnd.simpleplan.v2+json", "")
+	assert.True(t, strings.HasPrefix(rr.Body.String(), `{"id":1,`))
+
+	rr = serve("GET", "/plan/1", "application/vnd.simpleplan.v9+json", "")
+	assert.Equal(t, http.StatusNotAcceptable, rr.Code)
+
+	rr = serve("PUT", "/v2/plan/1", "", `{"data":{"attributes":{"name":"Renamed","description":"v2"}}}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"attributes":{"name":"Renamed","description":"v2","status":"draft"}`)
+
+	rr = serve("GET", "/v2/plan:batch", "", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestContentNegotiation(t *testing.T) {
+	app := &application{
+		config:   config{env: "test", repanic: true},
+		logger:   log.New(os.Stdout, "", log.Ldate|log.Ltime),
+		codecs:   codec.Default(),
+		PlanRepo: repo.NewPlanRepo(&testTime{}),
+	}
+	handler := app.handler()
+
+	serve := func(method, target, contentType, accept string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, bytes.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// XML in, MessagePack out
+	rr := serve("POST", "/v1/plan", "application/xml", "application/msgpack",
+		[]byte(`<Plan><name>From XML</name><description>x</description></Plan>`))
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, "application/msgpack", rr.Header().Get("Content-Type"))
+	var created model.Plan
+	assert.NoError(t, codec.MessagePack{}.Decode(rr.Body, &created))
+	assert.Equal(t, 1, created.ID)
+	assert.Equal(t, "From XML", created.Name)
+
+	rr = serve("GET", "/v1/plan/1", "", "application/xml", nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/xml", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Body.String(), "<name>From XML</name>")
+
+	// Lists have a single root element
+	rr = serve("GET", "/v1/plan", "", "application/xml", nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var list struct {
+		XMLName xml.Name     `xml:"plans"`
+		Plans   []model.Plan `xml:"plan"`
+	}
+	assert.NoError(t, xml.Unmarshal(rr.Body.Bytes(), &list))
+	assert.Len(t, list.Plans, 1)
+	assert.Equal(t, "From XML", list.Plans[0].Name)
+
+	rr = serve("POST", "/v1/plan:batch", "application/xml", "application/xml",
+		[]byte(`<batch><operations><operation><op>delete</op><id>9</id></operation></operations></batch>`))
+	assert.Equal(t, http.StatusMultiStatus, rr.Code)
+	assert.Contains(t, rr.Body.String(), "<results><result><index>0</index><op>delete</op><status>404</status>")
+
+	cborBody := new(bytes.Buffer)
+	assert.NoError(t, codec.CBOR{}.Encode(cborBody, model.Plan{Name: "From CBOR"}))
+	rr = serve("PUT", "/v1/plan/1", "application/cbor", "", cborBody.Bytes())
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Body.String(), `"name":"From CBOR"`)
+
+	// v2 keeps its vendor type for JSON only
+	rr = serve("GET", "/v2/plan/1", "", "application/vnd.simpleplan.v2+json", nil)
+	assert.Equal(t, "application/vnd.simpleplan.v2+json", rr.Header().Get("Content-Type"))
+	rr = serve("GET", "/v2/plan/1", "", "application/cbor", nil)
+	assert.Equal(t, "application/cbor", rr.Header().Get("Content-Type"))
+
+	rr = serve("POST", "/v1/plan", "text/plain", "", []byte("name"))
+	assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+	assert.JSONEq(t, `{"error":"unsupported media type"}`, rr.Body.String())
+
+	rr = serve("GET", "/v1/plan/1", "", "text/html", nil)
+	assert.Equal(t, http.StatusNotAcceptable, rr.Code)
+	assert.JSONEq(t, `{"error":"not acceptable"}`, rr.Body.String())
+
+	// Errors are in the negotiated codec too
+	rr = serve("GET", "/v1/plan/9", "", "application/xml", nil)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, "application/xml", rr.Header().Get("Content-Type"))
+	var xmlErr errorResponse
+	assert.NoError(t, xml.Unmarshal(rr.Body.Bytes(), &xmlErr))
+	assert.Equal(t, "not found", xmlErr.Error)
+
+	rr = serve("GET", "/v1/plan/9", "", "application/msgpack", nil)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, "application/msgpack", rr.Header().Get("Content-Type"))
+	var msgpackErr errorResponse
+	assert.NoError(t, codec.MessagePack{}.Decode(rr.Body, &msgpackErr))
+	assert.Equal(t, "not found", msgpackErr.Error)
+
+	// Export formats aren't negotiated
+	rr = serve("GET", "/v1/plan/export?format=csv", "", "text/csv", nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	plans, _ := app.PlanRepo.GetAll(10, 0)
+	assert.Len(t, plans, 1)
+}
+
+func TestRecoverPanic(t *testing.T) {
+	logs := new(bytes.Buffer)
+	logger := log.New(logs, "", 0)
+
+	r := router.New("/")
+	r.Add("/boom", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	r.Add("/late", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		panic("late")
+	}))
+	build := func(repanic bool) http.Handler {
+		d := router.Build(r)
+		d.Wrap(recoverPanic(logger, repanic))
+		d.Wrap(requestID)
+		return d
+	}
+	before := panics.Value()
+
+	req := httptest.NewRequest("GET", "/boom", nil)
+	req.Header.Set("X-Request-Id", "req-42")
+	rr := httptest.NewRecorder()
+	build(false).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "req-42", rr.Header().Get("X-Request-Id"))
+	assert.JSONEq(t, `{"type":"about:blank","title":"Internal Server Error","status":500,
+		"detail":"the server failed to handle the request","request_id":"req-42"}`, rr.Body.String())
+
+	var entry logPanic
+	assert.NoError(t, json.Unmarshal(logs.Bytes(), &entry))
+	assert.Equal(t, "boom", entry.Panic)
+	assert.Equal(t, "req-42", entry.RequestID)
+	assert.Contains(t, entry.Stack[0], "TestRecoverPanic")
+	assert.Equal(t, before+1, panics.Value())
+
+	// A response already started can only be aborted
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		build(false).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/late", nil))
+	})
+
+	// Tests see the panic
+	assert.PanicsWithValue(t, "boom", func() {
+		build(true).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/boom", nil))
+	})
+	assert.Equal(t, before+3, panics.Value())
+
+	// Generated IDs for missing or invalid ones
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/v1/health", nil)
+	req.Header.Set("X-Request-Id", "bad id")
+	(&application{config: config{env: "test"}}).handler().ServeHTTP(rr, req)
+	assert.Len(t, rr.Header().Get("X-Request-Id"), 32)
+}
+
+func TestCORS(t *testing.T) {
+	app := &application{
+		config: config{env: "test", repanic: true, cors: corsConfig{
+			origins: []string{"https://dashboard.example.com"},
+			maxAge:  time.Minute,
+		}},
+		PlanRepo: repo.NewPlanRepo(&testTime{}),
+	}
+	handler := app.handler()
+
+	req := httptest.NewRequest("OPTIONS", "/v1/plan/1", nil)
+	req.Header.Set("Origin", "https://dashboard.example.com")
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	req.Header.Set("Access-Control-Request-Headers", "Content-Type, Idempotency-Key")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, "https://dashboard.example.com", rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "DELETE, GET, HEAD, OPTIONS, PUT", rr.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "60", rr.Header().Get("Access-Control-Max-Age"))
+
+	req = httptest.NewRequest("GET", "/v2/health", nil)
+	req.Header.Set("Origin", "https://dashboard.example.com")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "https://dashboard.example.com", rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, rr.Header().Get("Access-Control-Expose-Headers"), "X-Request-Id")
+
+	// OPTIONS no longer ends up in a handler
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("OPTIONS", "/v1/plan", nil))
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, "GET, HEAD, OPTIONS, POST", rr.Header().Get("Allow"))
+}
+
+func TestCompression(t *testing.T) {
+	app := &application{
+		config:   config{env: "test", repanic: true, compressMin: 1024},
+		PlanRepo: repo.NewPlanRepo(&testTime{}),
+	}
+	for i := 0; i < 20; i++ {
+		_, err := app.PlanRepo.Create(&model.Plan{Name: "plan", Description: strings.Repeat("long description ", 10)})
+		assert.NoError(t, err)
+	}
+	handler := app.handler()
+
+	req := httptest.NewRequest("GET", "/v1/plan?limit=100", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Header().Values("Vary"), "Accept-Encoding")
+
+	zr, err := gzip.NewReader(rr.Body)
+	assert.NoError(t, err)
+	var plans []model.Plan
+	assert.NoError(t, json.NewDecoder(zr).Decode(&plans))
+	assert.Len(t, plans, 20)
+
+	// Small bodies are sent as is
+	req = httptest.NewRequest("GET", "/v1/health", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get("Content-Encoding"))
+	assert.Contains(t, rr.Body.String(), `"status":"ok"`)
+}
+
+func TestRequestBody(t *testing.T) {
+	app := &application{
+		config:   config{env: "test", repanic: true, maxBody: 64},
+		PlanRepo: repo.NewPlanRepo(&testTime{}),
+	}
+	handler := app.handler()
+
+	for _, tc := range []struct {
+		method, target, body string
+		status               int
+		err                  string
+	}{
+		{method: "POST", target: "/v1/plan", body: `{"name":"a"}`, status: http.StatusCreated},
+		{method: "POST", target: "/v1/plan", body: `{"name":"` + strings.Repeat("a", 64) + `"}`, status: http.StatusRequestEntityTooLarge, err: "request body too large"},
+		{method: "POST", target: "/v1/plan", body: `{"name":"a","owner":"b"}`, status: http.StatusBadRequest, err: "owner: unknown field"},
+		{method: "POST", target: "/v1/plan", body: `{"name":"a"}{"name":"b"}`, status: http.StatusBadRequest, err: "body must hold a single JSON value"},
+		{method: "PUT", target: "/v1/plan/1", body: `{"name":1}`, status: http.StatusBadRequest, err: "name: must be a string, got number"},
+		{method: "PUT", target: "/v1/plan/1", body: `{"name":`, status: http.StatusBadRequest, err: "malformed JSON, unexpected end of body"},
+		{method: "POST", target: "/v2/plan", body: `{"data":{"type":"plan","attributes":{"name":"a","extra":true}}}`, status: http.StatusBadRequest, err: "extra: unknown field"},
+		{method: "POST", target: "/v2/plan", body: `{"data":{"type":"task","attributes":{"name":"a"}}}`, status: http.StatusBadRequest, err: "data.type: must be \"plan\""},
+		// Imports have their own limit
+		{method: "POST", target: "/v1/plan/import", body: `{"name":"` + strings.Repeat("a", 64) + `"}`, status: http.StatusOK},
+	} {
+		req := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, tc.status, rr.Code, tc.body)
+
+		if tc.err != "" {
+			var res errorResponse
+			assert.NoError(t, json.NewDecoder(rr.Body).Decode(&res), tc.body)
+			assert.Equal(t, tc.err, res.Error, tc.body)
+		}
+	}
+
+	// Bodies of unknown length are cut while read
+	req := httptest.NewRequest("POST", "/v1/plan", strings.NewReader(`{"name":"`+strings.Repeat("a", 64)+`"}`))
+	req.ContentLength = -1
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+}
+
+// slowRepo takes delay to list and create plans.
+type slowRepo struct {
+	port.PlanRepo
+	delay time.Duration
+}
+
+func (r *slowRepo) GetAll(limit, page int) ([]*model.Plan, error) {
+	time.Sleep(r.delay)
+	return r.PlanRepo.GetAll(limit, page)
+}
+
+func (r *slowRepo) Create(plan *model.Plan) (*model.Plan, error) {
+	time.Sleep(r.delay)
+	return r.PlanRepo.Create(plan)
+}
+
+// panicRepo panics listing plans, after delay.
+type panicRepo struct {
+	port.PlanRepo
+	delay time.Duration
+}
+
+func (r *panicRepo) GetAll(int, int) ([]*model.Plan, error) {
+	time.Sleep(r.delay)
+	panic("listing failed")
+}
+
+func TestTimeoutPanic(t *testing.T) {
+	logs := new(bytes.Buffer)
+	newHandler := func(handlerTimeout, delay time.Duration) http.Handler {
+		app := &application{
+			config:   config{env: "test", handlerTimeout: handlerTimeout},
+			logger:   log.New(logs, "", 0),
+			PlanRepo: &panicRepo{PlanRepo: repo.NewPlanRepo(&testTime{}), delay: delay},
+		}
+		return app.handler()
+	}
+	before := panics.Value()
+
+	// With the default handler timeout, the stack is the one of the handler
+	rr := httptest.NewRecorder()
+	newHandler(10*time.Second, 0).ServeHTTP(rr, httptest.NewRequest("GET", "/v1/plan", nil))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Equal(t, before+1, panics.Value())
+
+	var entry logPanic
+	assert.NoError(t, json.Unmarshal(logs.Bytes(), &entry))
+	assert.Equal(t, "listing failed", entry.Panic)
+	assert.Contains(t, entry.Stack[0], "(*panicRepo).GetAll")
+	assert.Contains(t, strings.Join(entry.Stack, "\n"), "getAllPlanHandler")
+
+	// Panics after the timeout answered are logged and counted too
+	logs.Reset()
+	rr = httptest.NewRecorder()
+	newHandler(10*time.Millisecond, 50*time.Millisecond).ServeHTTP(rr, httptest.NewRequest("GET", "/v1/plan", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Eventually(t, func() bool { return panics.Value() == before+2 }, time.Second, 10*time.Millisecond)
+
+	// After the request log line of the timeout
+	entry = logPanic{}
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.NoError(t, json.Unmarshal([]byte(lines[len(lines)-1]), &entry))
+	assert.Equal(t, "listing failed", entry.Panic)
+	assert.Equal(t, "/v1/plan", entry.Path)
+	assert.Contains(t, entry.Stack[0], "(*panicRepo).GetAll")
+}
+
+// slowReader takes delay before reading.
+type slowReader struct {
+	io.Reader
+	delay time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(r.delay)
+	return r.Reader.Read(p)
+}
+
+func TestTimeout(t *testing.T) {
+	app := &application{
+		config:   config{env: "test", repanic: true, handlerTimeout: 20 * time.Millisecond},
+		PlanRepo: &slowRepo{PlanRepo: repo.NewPlanRepo(&testTime{}), delay: 100 * time.Millisecond},
+	}
+	handler := app.handler()
+
+	for _, target := range []string{"/v1/plan", "/v2/plan"} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", target, nil))
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code, target)
+		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"), target)
+		assert.JSONEq(t, `{"error":"request timed out"}`, rr.Body.String(), target)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/v1/plan/1", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	assert.Equal(t, http.StatusServiceUnavailable, errorStatus(fmt.Errorf("decode: %w", context.DeadlineExceeded)))
+}
+
+func TestTimeoutIdempotency(t *testing.T) {
+	plans := repo.NewPlanRepo(&testTime{})
+	newHandler := func(planRepo port.PlanRepo) http.Handler {
+		app := &application{
+			config:      config{env: "test", repanic: true, handlerTimeout: 20 * time.Millisecond},
+			idempotency: repo.NewIdempotencyRepo(&testTime{}, time.Hour),
+			PlanRepo:    planRepo,
+		}
+		return app.handler()
+	}
+	post := func(handler http.Handler, key string, body io.Reader) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/plan", body)
+		req.Header.Set("Idempotency-Key", key)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// The plan is created after the timeout answered, a retry replays the creation
+	handler := newHandler(&slowRepo{PlanRepo: plans, delay: 50 * time.Millisecond})
+	rr := post(handler, "slow-repo", strings.NewReader(`{"name":"Once"}`))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Eventually(t, func() bool {
+		all, _ := plans.GetAll(10, 0)
+		return len(all) == 1
+	}, time.Second, 10*time.Millisecond)
+	rr = post(handler, "slow-repo", strings.NewReader(`{"name":"Once"}`))
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, "true", rr.Header().Get("Idempotent-Replayed"))
+	all, _ := plans.GetAll(10, 0)
+	assert.Len(t, all, 1)
+
+	// A body decoded after the timeout changes nothing
+	handler = newHandler(plans)
+	rr = post(handler, "", &slowReader{Reader: strings.NewReader(`{"name":"Late"}`), delay: 50 * time.Millisecond})
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	time.Sleep(150 * time.Millisecond)
+	all, _ = plans.GetAll(10, 0)
+	assert.Len(t, all, 1)
+}
+
+// issuedCert is a certificate generated for tests.
+type issuedCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// issue generates a certificate for name signed by parent, a CA when parent is nil.
+func issue(t *testing.T, name string, serial int64, parent *issuedCert) *issuedCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	return &issuedCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, b []byte) string {
+		file := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(file, b, 0o600))
+		return file
+	}
+
+	ca := issue(t, "test CA", 1, nil)
+	server := issue(t, "server", 2, ca)
+	client := issue(t, "sidecar", 3, ca)
+	cfg := tlsConfig{
+		certFile:     write("server.pem", server.certPEM),
+		keyFile:      write("server-key.pem", server.keyPEM),
+		clientCAFile: write("ca.pem", ca.certPEM),
+		minVersion:   "1.2",
+		ciphers:      "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+	}
+
+	store, err := newCertStore(cfg.certFile, cfg.keyFile, cfg.clientCAFile, log.New(io.Discard, "", 0))
+	assert.NoError(t, err)
+	serverTLS, err := cfg.serverTLS(store)
+	assert.NoError(t, err)
+
+	app := &application{config: config{env: "test", repanic: true}, PlanRepo: repo.NewPlanRepo(&testTime{})}
+	r := router.New("/")
+	r.Add("/whoami", app.errHandler(func(w http.ResponseWriter, r *http.Request) error {
+		id := clientIdentityOf(r)
+		if id == nil {
+			return model.ErrNotFound
+		}
+		return json.NewEncoder(w).Encode(id)
+	}))
+	d := router.Build(append(app.routes(), r)...)
+	d.Wrap(identifyClient)
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", serverTLS)
+	assert.NoError(t, err)
+	srv := &http.Server{Handler: d}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	clientCert, err := tls.X509KeyPair(client.certPEM, client.keyPEM)
+	assert.NoError(t, err)
+	get := func(clientTLS *tls.Config) (*http.Response, error) {
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+		return c.Get("https://" + l.Addr().String() + "/whoami")
+	}
+
+	res, err := get(&tls.Config{RootCAs: roots, Certificates: []tls.Certificate{clientCert}})
+	assert.NoError(t, err)
+	var id clientIdentity
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&id))
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "sidecar", id.CommonName)
+	assert.Equal(t, "3", id.Serial)
+	assert.Equal(t, "2", res.TLS.PeerCertificates[0].SerialNumber.String())
+
+	// Clients without a certificate or an old TLS version are refused
+	_, err = get(&tls.Config{RootCAs: roots})
+	assert.Error(t, err)
+	_, err = get(&tls.Config{RootCAs: roots, Certificates: []tls.Certificate{clientCert}, MaxVersion: tls.VersionTLS11})
+	assert.Error(t, err)
+
+	// A renewed certificate is served without restart, broken files are ignored
+	write("server.pem", []byte("broken"))
+	reloaded, err := store.reload()
+	assert.False(t, reloaded)
+	assert.Error(t, err)
+
+	renewed := issue(t, "server", 4, ca)
+	write("server-key.pem", renewed.keyPEM)
+	write("server.pem", renewed.certPEM)
+	reloaded, err = store.reload()
+	assert.True(t, reloaded)
+	assert.NoError(t, err)
+
+	res, err = get(&tls.Config{RootCAs: roots, Certificates: []tls.Certificate{clientCert}})
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, "4", res.TLS.PeerCertificates[0].SerialNumber.String())
+
+	// Invalid settings
+	_, err = tlsConfig{certFile: cfg.certFile, keyFile: cfg.keyFile, minVersion: "2"}.serverTLS(store)
+	assert.Error(t, err)
+	_, err = tlsConfig{certFile: cfg.certFile, keyFile: cfg.keyFile, ciphers: "TLS_RSA_WITH_RC4_128_SHA"}.serverTLS(store)
+	assert.Error(t, err)
+	_, err = tlsConfig{certFile: cfg.certFile}.serverTLS(store)
+	assert.Error(t, err)
+}
+
+func TestAdmin(t *testing.T) {
+	logs := new(bytes.Buffer)
+	defer setLogLevel(levelInfo)
+
+	app := &application{
+		config:   config{env: "test", repanic: true},
+		logger:   log.New(logs, "", 0),
+		PlanRepo: repo.NewPlanRepo(&testTime{}),
+	}
+	handler := app.handler()
+
+	fs := flag.NewFlagSet("api", flag.ContinueOnError)
+	fs.Int("port", 4000, "")
+	fs.String("tls-key", "", "")
+	fs.String("tls-cert", "", "")
+	fs.Var(levelFlag{}, "log-level", "")
+	assert.NoError(t, fs.Parse([]string{"-tls-key", "/etc/api/key.pem", "-log-level", "debug"}))
+	admin := app.adminHandler(handler, fs)
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		admin.ServeHTTP(rr, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rr
+	}
+
+	rr := do("GET", "/debug/pprof/", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "goroutine")
+	rr = do("GET", "/debug/pprof/goroutine?debug=1", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "goroutine profile")
+
+	// The command line may hold secrets
+	rr = do("GET", "/debug/pprof/cmdline", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	var vars struct {
+		Runtime runtimeInfo      `json:"runtime"`
+		Panics  *int64           `json:"panics"`
+		Cmdline *json.RawMessage `json:"cmdline"`
+	}
+	rr = do("GET", "/debug/vars", "")
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&vars))
+	assert.Greater(t, vars.Runtime.Goroutines, 0)
+	assert.Greater(t, vars.Runtime.Memory.Sys, uint64(0))
+	assert.NotNil(t, vars.Panics)
+	assert.Nil(t, vars.Cmdline)
+
+	var routes []routeEntry
+	rr = do("GET", "/debug/routes", "")
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&routes))
+	found := false
+	for _, rt := range routes {
+		found = found || rt.Method == "POST" && rt.Pattern == "/v1/plan" && rt.Name == "plan.create"
+	}
+	assert.True(t, found, "POST /v1/plan in %v", routes)
+
+	var cfg map[string]string
+	rr = do("GET", "/debug/config", "")
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&cfg))
+	assert.Equal(t, map[string]string{"port": "4000", "tls-key": "[REDACTED]", "tls-cert": "", "log-level": "debug"}, cfg)
+
+	// Successful requests aren't logged from the warn level on
+	rr = do("PUT", "/debug/log-level", `{"level":"warn"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"level":"warn"}`, rr.Body.String())
+	assert.JSONEq(t, `{"level":"warn"}`, do("GET", "/debug/log-level", "").Body.String())
+
+	logs.Reset()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/plan", nil))
+	assert.Empty(t, logs.String())
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/plan/1", nil))
+	assert.Contains(t, logs.String(), `"level":"warn"`)
+
+	rr = do("PUT", "/debug/log-level", `{"level":"verbose"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, levelWarn, getLogLevel())
+	assert.Equal(t, http.StatusNotFound, do("GET", "/v1/plan", "").Code)
+}
+
+func TestPlanStatus(t *testing.T) {
+	sm, err := model.ParseStateMachine("draft:active;active:done")
+	assert.NoError(t, err)
+	app := &application{
+		config:   config{env: "test", repanic: true, transitions: sm},
+		PlanRepo: repo.NewPlanRepo(&testTime{}),
+	}
+	handler := app.handler()
+	for _, name := range []string{"First", "Second"} {
+		_, err := app.PlanRepo.Create(&model.Plan{Name: name})
+		assert.NoError(t, err)
+	}
+
+	for _, tc := range []struct {
+		method       string
+		target, body string
+		status       int
+		err          string
+	}{
+		// Statuses change by transition only
+		{method: "POST", target: "/v1/plan", body: `{"name":"Third","status":"active"}`, status: http.StatusBadRequest, err: "invalid operation: new plans start in draft"},
+		{method: "POST", target: "/v2/plan", body: `{"data":{"attributes":{"name":"Third","status":"active"}}}`, status: http.StatusBadRequest, err: "invalid operation: new plans start in draft"},
+		{method: "PUT", target: "/v1/plan/2", body: `{"name":"Second","status":"active"}`, status: http.StatusBadRequest, err: "invalid operation: the status changes by transition only"},
+		{method: "PUT", target: "/v2/plan/2", body: `{"data":{"attributes":{"name":"Second","status":"active"}}}`, status: http.StatusBadRequest, err: "invalid operation: the status changes by transition only"},
+		{method: "PUT", target: "/v1/plan/2", body: `{"name":"Second","status":"draft"}`, status: http.StatusOK},
+		{method: "POST", target: "/v2/plan/2/transition", body: `{"data":{"attributes":{"status":"done"}}}`, status: http.StatusConflict, err: "illegal status transition from draft to done"},
+		{target: "/v1/plan/1/transition", body: `{"status":"active"}`, status: http.StatusOK},
+		{target: "/v1/plan/1/transition", body: `{"status":"draft"}`, status: http.StatusConflict, err: "illegal status transition from active to draft"},
+		// Allowed by default, not by the configured transitions
+		{target: "/v1/plan/2/transition", body: `{"status":"cancelled"}`, status: http.StatusConflict, err: "illegal status transition from draft to cancelled"},
+		{target: "/v1/plan/1/transition", body: `{"status":"started"}`, status: http.StatusBadRequest, err: `invalid status "started"`},
+		{target: "/v1/plan/100/transition", body: `{"status":"active"}`, status: http.StatusNotFound, err: "not found"},
+		{target: "/v1/plan/1/transition", body: `{"status":"done"}`, status: http.StatusOK},
+	} {
+		method := tc.method
+		if method == "" {
+			method = "POST"
+		}
+		req := httptest.NewRequest(method, tc.target, strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, tc.status, rr.Code, tc.target+" "+tc.body)
+
+		if tc.err != "" {
+			var res errorResponse
+			assert.NoError(t, json.NewDecoder(rr.Body).Decode(&res), tc.body)
+			assert.Equal(t, tc.err, res.Error, tc.body)
+		}
+	}
+
+	var plans []model.Plan
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/v1/plan?status=done", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&plans))
+	now := (&testTime{}).Now()
+	assert.Equal(t, []model.Plan{{
+		ID: 1, Name: "First", Status: model.StatusDone, CreatedAt: now, UpdatedAt: now,
+		Transitions: []model.StatusTransition{
+			{From: model.StatusDraft, To: model.StatusActive, At: now},
+			{From: model.StatusActive, To: model.StatusDone, At: now},
+		},
+	}}, plans)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/v1/plan?status=draft", nil))
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&plans))
+	assert.Len(t, plans, 1)
+	assert.Equal(t, "Second", plans[0].Name)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/v1/plan?status=started", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// v2 has the same transitions and filter, the history is metadata
+	req := httptest.NewRequest("POST", "/v2/plan/2/transition", strings.NewReader(`{"data":{"attributes":{"status":"active"}}}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"attributes":{"name":"Second","description":"","status":"active"}`)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/v2/plan?status=done", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"data":[{"id":1,"type":"plan","attributes":{"name":"First","description":"","status":"done"},
+		"meta":{"created_at":"2006-01-02T15:04:05Z","updated_at":"2006-01-02T15:04:05Z","transitions":[
+			{"from":"draft","to":"active","at":"2006-01-02T15:04:05Z"},
+			{"from":"active","to":"done","at":"2006-01-02T15:04:05Z"}]}}],
+		"meta":{"page":0,"limit":10,"count":1}}`, rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/v2/plan?status=started", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
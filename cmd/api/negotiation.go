@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/h4ckm03d/simpleplan/codec"
+)
+
+type codecsKey struct{}
+
+// negotiated holds the codecs picked for a request.
+type negotiated struct {
+	req codec.Codec
+	res codec.Codec
+}
+
+// defaultCodecs decode JSON bodies strictly, unknown fields are mistakes of clients.
+var defaultCodecs = codec.NewRegistry(codec.JSON{Strict: true}, codec.XML{}, codec.MessagePack{}, codec.CBOR{})
+
+// registry returns the application codecs, the default ones if none are set.
+func (app *application) registry() *codec.Registry {
+	if app.codecs == nil {
+		return defaultCodecs
+	}
+
+	return app.codecs
+}
+
+// negotiate picks the codec decoding the request body by Content-Type and the
+// codec encoding the response by Accept, answering 415 or 406 if there's none.
+func (app *application) negotiate(next http.Handler) http.Handler {
+	codecs := app.registry()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n negotiated
+		var err error
+
+		if r.ContentLength != 0 {
+			if n.req, err = codecs.ForContentType(r.Header.Get("Content-Type")); err != nil {
+				writeError(w, r, http.StatusUnsupportedMediaType, err)
+				return
+			}
+		}
+
+		w.Header().Add("Vary", "Accept")
+		if n.res, err = codecs.Negotiate(r.Header.Get("Accept")); err != nil {
+			writeError(w, r, http.StatusNotAcceptable, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), codecsKey{}, n)))
+	})
+}
+
+// codecs returns the negotiated codecs, strict JSON for requests not negotiated.
+func codecs(r *http.Request) negotiated {
+	n, _ := r.Context().Value(codecsKey{}).(negotiated)
+	if n.req == nil {
+		n.req = codec.JSON{Strict: true}
+	}
+	if n.res == nil {
+		n.res = codec.JSON{Strict: true}
+	}
+
+	return n
+}
+
+// decode reads the request body with the negotiated codec. Once the handler timeout
+// expired it fails with the context error, so handlers don't change anything after
+// the timeout response is sent.
+func (app *application) decode(r *http.Request, v interface{}) error {
+	if err := codecs(r).req.Decode(r.Body, v); err != nil {
+		return err
+	}
+
+	return r.Context().Err()
+}
+
+// respond writes status and v with the negotiated codec. A content type set
+// before, such as a vendor type, is kept when it belongs to the same codec.
+func (app *application) respond(w http.ResponseWriter, r *http.Request, status int, v interface{}) error {
+	c := codecs(r).res
+	current, _, _ := strings.Cut(w.Header().Get("Content-Type"), ";")
+	if app.registry().Lookup(strings.TrimSpace(current)) != c {
+		w.Header().Set("Content-Type", codec.MediaType(c))
+	}
+
+	w.WriteHeader(status)
+
+	return c.Encode(w, v)
+}
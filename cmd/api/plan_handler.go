@@ -1,8 +1,8 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
@@ -10,33 +10,8 @@ import (
 	"github.com/h4ckm03d/simpleplan/router"
 )
 
-func (app *application) planHandler(w http.ResponseWriter, r *http.Request) error {
-	switch r.Method {
-	case "GET":
-		return app.getAllPlanHandler(w, r)
-	case "POST":
-		return app.createPlanHandler(w, r)
-	case "DELETE":
-	}
-
-	return errors.New("not found")
-}
-
-func (app *application) planMutationHandler(w http.ResponseWriter, r *http.Request) error {
-	switch r.Method {
-	case "GET":
-		return app.getPlanHandler(w, r)
-	case "PUT":
-		return app.updatePlanHandler(w, r)
-	case "DELETE":
-		return app.deletePlanHandler(w, r)
-	}
-
-	return errors.New("not found")
-}
-
 func (app *application) getPlanHandler(w http.ResponseWriter, r *http.Request) error {
-	id, err := strconv.Atoi(router.Param(r, "id"))
+	id, err := router.ParamInt(r, "id")
 	if err != nil {
 		return err
 	}
@@ -46,17 +21,17 @@ func (app *application) getPlanHandler(w http.ResponseWriter, r *http.Request) e
 		return err
 	}
 
-	return json.NewEncoder(w).Encode(data)
+	return app.respond(w, r, http.StatusOK, data)
 }
 
 func (app *application) updatePlanHandler(w http.ResponseWriter, r *http.Request) error {
-	id, err := strconv.Atoi(router.Param(r, "id"))
+	id, err := router.ParamInt(r, "id")
 	if err != nil {
 		return err
 	}
 	var update *model.Plan
 	defer dclose(r.Body)
-	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+	if err := app.decode(r, &update); err != nil {
 		return err
 	}
 
@@ -67,7 +42,7 @@ func (app *application) updatePlanHandler(w http.ResponseWriter, r *http.Request
 		return err
 	}
 
-	return json.NewEncoder(w).Encode(data)
+	return app.respond(w, r, http.StatusOK, data)
 }
 
 func (app *application) createPlanHandler(w http.ResponseWriter, r *http.Request) error {
@@ -77,7 +52,7 @@ func (app *application) createPlanHandler(w http.ResponseWriter, r *http.Request
 
 	var plan *model.Plan
 	defer dclose(r.Body)
-	if err := json.NewDecoder(r.Body).Decode(&plan); err != nil {
+	if err := app.decode(r, &plan); err != nil {
 		return err
 	}
 
@@ -86,29 +61,93 @@ func (app *application) createPlanHandler(w http.ResponseWriter, r *http.Request
 		return err
 	}
 
-	w.WriteHeader(http.StatusCreated)
-
-	return json.NewEncoder(w).Encode(data)
+	return app.respond(w, r, http.StatusCreated, data)
 }
 
-func (app *application) getAllPlanHandler(w http.ResponseWriter, r *http.Request) error {
+// pagination reads the limit and page query values, limit defaults to 10 and is at
+// most 100, pages start at 0.
+func pagination(r *http.Request) (int, int, error) {
 	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
 	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
 
-	if limit == 0 || limit > 100 {
+	if limit <= 0 || limit > 100 {
 		limit = 10
 	}
+	if page < 0 {
+		return 0, 0, fmt.Errorf("page: invalid value %d, pages start at 0", page)
+	}
 
-	data, err := app.PlanRepo.GetAll(limit, page)
+	return limit, page, nil
+}
+
+// listPlans returns a page of plans, only the ones in the status query value if set.
+func (app *application) listPlans(r *http.Request, limit, page int) ([]*model.Plan, error) {
+	s := r.URL.Query().Get("status")
+	if s == "" {
+		return app.PlanRepo.GetAll(limit, page)
+	}
+
+	status, err := model.ParseStatus(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return app.PlanRepo.GetAllByStatus(status, limit, page)
+}
+
+func (app *application) getAllPlanHandler(w http.ResponseWriter, r *http.Request) error {
+	limit, page, err := pagination(r)
 	if err != nil {
 		return err
 	}
 
-	return json.NewEncoder(w).Encode(data)
+	data, err := app.listPlans(r, limit, page)
+	if err != nil {
+		return err
+	}
+
+	return app.respond(w, r, http.StatusOK, data)
+}
+
+// transitionRequest is the body of a plan status change.
+type transitionRequest struct {
+	Status string `json:"status" xml:"status"`
+}
+
+// transitionPlanHandler moves a plan to another status, 409 if the state machine
+// doesn't allow it from the current status.
+func (app *application) transitionPlanHandler(w http.ResponseWriter, r *http.Request) error {
+	var req transitionRequest
+	defer dclose(r.Body)
+	if err := app.decode(r, &req); err != nil {
+		return err
+	}
+
+	data, err := app.transition(r, req.Status)
+	if err != nil {
+		return err
+	}
+
+	return app.respond(w, r, http.StatusOK, data)
+}
+
+// transition moves the plan of the id route parameter to the status named s.
+func (app *application) transition(r *http.Request, s string) (*model.Plan, error) {
+	id, err := router.ParamInt(r, "id")
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := model.ParseStatus(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return app.PlanRepo.Transition(id, status, app.stateMachine())
 }
 
 func (app *application) deletePlanHandler(w http.ResponseWriter, r *http.Request) error {
-	id, err := strconv.Atoi(router.Param(r, "id"))
+	id, err := router.ParamInt(r, "id")
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/h4ckm03d/simpleplan/codec"
+	"github.com/h4ckm03d/simpleplan/model"
+	"github.com/h4ckm03d/simpleplan/router"
+)
+
+// planAttributes are the fields of a plan set by clients of API v2. The status
+// is changed with a transition, creates and updates only accept the current one.
+type planAttributes struct {
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Status      model.Status `json:"status,omitempty"`
+}
+
+type planMeta struct {
+	CreatedAt   time.Time                `json:"created_at"`
+	UpdatedAt   time.Time                `json:"updated_at"`
+	Transitions []model.StatusTransition `json:"transitions,omitempty"`
+}
+
+// planResource is the API v2 representation of a plan.
+type planResource struct {
+	ID         int            `json:"id"`
+	Type       string         `json:"type"`
+	Attributes planAttributes `json:"attributes"`
+	Meta       planMeta       `json:"meta"`
+}
+
+type pageMeta struct {
+	Page  int `json:"page"`
+	Limit int `json:"limit"`
+	Count int `json:"count"`
+}
+
+// envelope wraps every API v2 response body.
+type envelope struct {
+	Data interface{} `json:"data"`
+	Meta *pageMeta   `json:"meta,omitempty"`
+}
+
+// planRequest is the API v2 body of plan creates and updates.
+type planRequest struct {
+	Data struct {
+		Type       string         `json:"type,omitempty"`
+		Attributes planAttributes `json:"attributes"`
+	} `json:"data"`
+}
+
+// transitionV2Request is the API v2 body of plan status changes.
+type transitionV2Request struct {
+	Data struct {
+		Attributes transitionRequest `json:"attributes"`
+	} `json:"data"`
+}
+
+func newPlanResource(p *model.Plan) planResource {
+	return planResource{
+		ID:   p.ID,
+		Type: "plan",
+		Attributes: planAttributes{
+			Name:        p.Name,
+			Description: p.Description,
+			Status:      p.Status,
+		},
+		Meta: planMeta{
+			CreatedAt:   p.CreatedAt,
+			UpdatedAt:   p.UpdatedAt,
+			Transitions: p.Transitions,
+		},
+	}
+}
+
+func (app *application) decodePlanRequest(r *http.Request) (*model.Plan, error) {
+	if r.ContentLength == 0 {
+		return nil, errors.New("empty body")
+	}
+
+	var req planRequest
+	defer dclose(r.Body)
+	if err := app.decode(r, &req); err != nil {
+		return nil, err
+	}
+	if req.Data.Type != "" && req.Data.Type != "plan" {
+		return nil, &codec.FieldError{Field: "data.type", Message: `must be "plan"`}
+	}
+
+	attrs := req.Data.Attributes
+	return &model.Plan{Name: attrs.Name, Description: attrs.Description, Status: attrs.Status}, nil
+}
+
+func (app *application) listPlanV2Handler(w http.ResponseWriter, r *http.Request) error {
+	limit, page, err := pagination(r)
+	if err != nil {
+		return err
+	}
+
+	plans, err := app.listPlans(r, limit, page)
+	if err != nil {
+		return err
+	}
+
+	data := make([]planResource, 0, len(plans))
+	for _, p := range plans {
+		data = append(data, newPlanResource(p))
+	}
+
+	return app.respond(w, r, http.StatusOK, envelope{
+		Data: data,
+		Meta: &pageMeta{Page: page, Limit: limit, Count: len(data)},
+	})
+}
+
+func (app *application) getPlanV2Handler(w http.ResponseWriter, r *http.Request) error {
+	id, err := router.ParamInt(r, "id")
+	if err != nil {
+		return err
+	}
+
+	plan, err := app.PlanRepo.Get(id)
+	if err != nil {
+		return err
+	}
+
+	return app.respond(w, r, http.StatusOK, envelope{Data: newPlanResource(plan)})
+}
+
+func (app *application) createPlanV2Handler(w http.ResponseWriter, r *http.Request) error {
+	plan, err := app.decodePlanRequest(r)
+	if err != nil {
+		return err
+	}
+
+	created, err := app.PlanRepo.Create(plan)
+	if err != nil {
+		return err
+	}
+
+	return app.respond(w, r, http.StatusCreated, envelope{Data: newPlanResource(created)})
+}
+
+func (app *application) updatePlanV2Handler(w http.ResponseWriter, r *http.Request) error {
+	id, err := router.ParamInt(r, "id")
+	if err != nil {
+		return err
+	}
+
+	plan, err := app.decodePlanRequest(r)
+	if err != nil {
+		return err
+	}
+	plan.ID = id
+
+	if _, err := app.PlanRepo.Update(plan); err != nil {
+		return err
+	}
+
+	// Answer the stored plan, timestamps included
+	updated, err := app.PlanRepo.Get(id)
+	if err != nil {
+		return err
+	}
+
+	return app.respond(w, r, http.StatusOK, envelope{Data: newPlanResource(updated)})
+}
+
+func (app *application) transitionPlanV2Handler(w http.ResponseWriter, r *http.Request) error {
+	var req transitionV2Request
+	defer dclose(r.Body)
+	if err := app.decode(r, &req); err != nil {
+		return err
+	}
+
+	plan, err := app.transition(r, req.Data.Attributes.Status)
+	if err != nil {
+		return err
+	}
+
+	return app.respond(w, r, http.StatusOK, envelope{Data: newPlanResource(plan)})
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/h4ckm03d/simpleplan/router"
+)
+
+// panics counts the panics recovered by recoverPanic, published with expvar.
+var panics = expvar.NewInt("panics")
+
+// problem is an RFC 7807 problem details body.
+type problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+type logPanic struct {
+	Level     string   `json:"level"`
+	Msg       string   `json:"msg"`
+	Panic     string   `json:"panic"`
+	RequestID string   `json:"request_id,omitempty"`
+	Method    string   `json:"method"`
+	Path      string   `json:"path"`
+	Stack     []string `json:"stack"`
+	Time      string   `json:"time"`
+}
+
+// recoverPanic turns a panic of the next handler, route matching included when it
+// wraps the dispatcher, into a 500 problem response. The panic is logged to logger
+// with its stack and counted. With repanic set, as in tests, the panic goes on once logged.
+func recoverPanic(logger *log.Logger, repanic bool) router.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tw := &trackingWriter{ResponseWriter: w}
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				// Raised on purpose to abort the response
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+
+				panics.Add(1)
+				logRecovered(logger, r, p)
+				if repanic {
+					panic(p)
+				}
+
+				// Too late for an error response, abort the connection
+				if tw.wroteHeader {
+					panic(http.ErrAbortHandler)
+				}
+
+				tw.Header().Set("Content-Type", "application/problem+json")
+				tw.WriteHeader(http.StatusInternalServerError)
+				if err := json.NewEncoder(tw).Encode(problem{
+					Type:      "about:blank",
+					Title:     http.StatusText(http.StatusInternalServerError),
+					Status:    http.StatusInternalServerError,
+					Detail:    "the server failed to handle the request",
+					RequestID: requestIDOf(r),
+				}); err != nil {
+					logger.Println(err)
+				}
+			}()
+
+			next.ServeHTTP(tw, r)
+		})
+	}
+}
+
+// logRecovered writes a recovered panic as a JSON line. It must be called by the
+// deferred function recovering, the stack starts at the function that panicked,
+// in the goroutine that panicked for a *router.PanicError.
+func logRecovered(logger *log.Logger, r *http.Request, p interface{}) {
+	var frames []string
+	if pe, ok := p.(*router.PanicError); ok {
+		p, frames = pe.Value, stackLines(pe.Stack)
+	} else {
+		frames = stack(5)
+	}
+
+	if err := json.NewEncoder(logger.Writer()).Encode(logPanic{
+		Level:     "error",
+		Msg:       "panic recovered",
+		Panic:     fmt.Sprint(p),
+		RequestID: requestIDOf(r),
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Stack:     frames,
+		Time:      time.Now().UTC().Format(time.RFC3339Nano),
+	}); err != nil {
+		logger.Println(err)
+	}
+}
+
+// latePanic logs and counts the panics of handlers that the timeout already answered.
+func latePanic(logger *log.Logger) func(*http.Request, *router.PanicError) {
+	return func(r *http.Request, p *router.PanicError) {
+		logRecovered(logger, r, p)
+		panics.Add(1)
+	}
+}
+
+// stack returns the frames of the calling goroutine as "function file:line",
+// skipping the first skip frames.
+func stack(skip int) []string {
+	pc := make([]uintptr, 64)
+	n := runtime.Callers(skip, pc)
+
+	return stackLines(pc[:n])
+}
+
+// stackLines formats the frames of the program counters pc as "function file:line".
+func stackLines(pc []uintptr) []string {
+	frames := runtime.CallersFrames(pc)
+
+	lines := make([]string, 0, len(pc))
+	for {
+		f, more := frames.Next()
+		lines = append(lines, fmt.Sprintf("%s %s:%d", f.Function, f.File, f.Line))
+		if !more {
+			break
+		}
+	}
+
+	return lines
+}
+
+// trackingWriter records if the response header was sent.
+type trackingWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *trackingWriter) WriteHeader(status int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *trackingWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *trackingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.wroteHeader = true
+		f.Flush()
+	}
+}
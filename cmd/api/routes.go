@@ -1,66 +1,267 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strings"
+	"text/tabwriter"
 	"time"
 
+	"github.com/h4ckm03d/simpleplan/codec"
 	"github.com/h4ckm03d/simpleplan/model"
 	"github.com/h4ckm03d/simpleplan/router"
 )
 
 type logRequest struct {
+	Level    string `json:"level,omitempty"`
 	Method   string `json:"method,omitempty"`
 	Path     string `json:"path,omitempty"`
+	Query    string `json:"query,omitempty"`
 	Duration int64  `json:"duration"`
+	Client   string `json:"client,omitempty"`
 	Err      string `json:"error,omitempty"`
 }
 
 // Middleware to set content type
 func restMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Set header
-		w.Header().Set("Content-Type", "application/json")
+	return contentType("application/json")(next)
+}
 
-		// Continue flow
-		next.ServeHTTP(w, r)
-	})
+// contentType sets the response content type.
+func contentType(ct string) router.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Set header
+			w.Header().Set("Content-Type", ct)
+
+			// Continue flow
+			next.ServeHTTP(w, r)
+		})
+	}
 }
 
-func errHandler(f func(http.ResponseWriter, *http.Request) error) http.HandlerFunc {
+// errHandler answers the error of f with a JSON error body and logs the request
+// with the application logger.
+func (app *application) errHandler(f func(http.ResponseWriter, *http.Request) error) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		err := f(w, r)
 		var errMessage string
 
+		level := levelInfo
 		if err != nil {
 			errMessage = err.Error()
-			switch err.Error() {
-			case model.ErrNotFound.Error():
-				w.WriteHeader(http.StatusNotFound)
-			default:
-				w.WriteHeader(http.StatusBadRequest)
+			status := errorStatus(err)
+			writeError(w, r, status, err)
+
+			level = levelWarn
+			if status >= http.StatusInternalServerError {
+				level = levelError
 			}
 		}
+		if !logEnabled(level) {
+			return
+		}
 
-		if err := json.NewEncoder(log.Writer()).Encode(logRequest{
+		entry := logRequest{
+			Level:    level.String(),
 			Method:   r.Method,
 			Path:     r.URL.Path,
 			Duration: time.Since(start).Microseconds(),
 			Err:      errMessage,
-		}); err != nil {
-			log.Fatal(err)
+		}
+		if id := clientIdentityOf(r); id != nil {
+			entry.Client = id.CommonName
+		}
+		if logEnabled(levelDebug) {
+			entry.Query = r.URL.RawQuery
+		}
+
+		if err := json.NewEncoder(app.log().Writer()).Encode(entry); err != nil {
+			app.log().Fatal(err)
 		}
 	}
 }
 
-func (app *application) routes() router.Router {
+// errorStatus maps a handler error to its response status.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, model.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, model.ErrMethodNotAllowed):
+		return http.StatusMethodNotAllowed
+	case errors.Is(err, model.ErrIllegalTransition), errors.Is(err, model.ErrAlreadyExists):
+		return http.StatusConflict
+	case errors.Is(err, codec.ErrUnsupportedMediaType):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, codec.ErrNotAcceptable):
+		return http.StatusNotAcceptable
+	case errors.Is(err, router.ErrBodyTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, model.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		// The handler timeout expired
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// errorHandler answers err for every request.
+func (app *application) errorHandler(err error) http.Handler {
+	return app.errHandler(func(http.ResponseWriter, *http.Request) error {
+		return err
+	})
+}
+
+// routes returns a router per API version. Each version shares the plan repository.
+func (app *application) routes() []router.Router {
+	return []router.Router{app.v1Routes(), app.v2Routes()}
+}
+
+func (app *application) v1Routes() router.Router {
 	// Create route
 	r := router.New("/v1")
 	r.Wrap(restMiddleware)
-	r.Add("/health", errHandler(app.healthcheckHandler))
-	r.Add("/plan", errHandler(app.planHandler))
-	r.Add("/plan/:id", errHandler(app.planMutationHandler))
+	app.deprecate(r, "v1")
+
+	// Import and export bodies are in the format of the format query value
+	r.Handle(http.MethodGet, "/plan/export", app.errHandler(app.exportPlanHandler)).Name("plan.export")
+	r.Handle(http.MethodPost, "/plan/import", app.errHandler(app.importPlanHandler)).Name("plan.import").
+		Wrap(app.bodyLimit(maxImportBody))
+
+	r.Group("/", func(r router.Router) {
+		r.Wrap(app.negotiate)
+		app.limitBody(r)
+		app.timeout(r)
+		r.Handle(http.MethodGet, "/health", app.errHandler(app.healthcheckHandler)).Name("health")
+		r.Handle(http.MethodPost, "/plan:batch", app.errHandler(app.batchPlanHandler)).Name("plan.batch")
+		r.Group("/plan", func(r router.Router) {
+			r.Handle(http.MethodGet, "/", app.errHandler(app.getAllPlanHandler)).Name("plan.list")
+			r.Handle(http.MethodPost, "/", app.idempotent(app.errHandler(app.createPlanHandler))).Name("plan.create")
+			r.Handle(http.MethodGet, "/:id<int>", app.errHandler(app.getPlanHandler)).Name("plan.get")
+			r.Handle(http.MethodPut, "/:id<int>", app.errHandler(app.updatePlanHandler)).Name("plan.update")
+			r.Handle(http.MethodDelete, "/:id<int>", app.errHandler(app.deletePlanHandler)).Name("plan.delete")
+			r.Handle(http.MethodPost, "/:id<int>/transition", app.errHandler(app.transitionPlanHandler)).Name("plan.transition")
+		})
+	})
+	app.allowCORS(r)
 	return r
 }
+
+// v2Routes serves plans wrapped in an envelope, with their timestamps as metadata.
+func (app *application) v2Routes() router.Router {
+	r := router.New("/v2")
+	r.Wrap(contentType(mediaType("v2")))
+	r.Wrap(app.negotiate)
+	app.limitBody(r)
+	app.timeout(r)
+	app.deprecate(r, "v2")
+	r.Handle(http.MethodGet, "/health", app.errHandler(app.healthcheckHandler)).Name("health")
+	r.Group("/plan", func(r router.Router) {
+		r.Handle(http.MethodGet, "/", app.errHandler(app.listPlanV2Handler)).Name("plan.list")
+		r.Handle(http.MethodPost, "/", app.idempotent(app.errHandler(app.createPlanV2Handler))).Name("plan.create")
+		r.Handle(http.MethodGet, "/:id<int>", app.errHandler(app.getPlanV2Handler)).Name("plan.get")
+		r.Handle(http.MethodPut, "/:id<int>", app.errHandler(app.updatePlanV2Handler)).Name("plan.update")
+		r.Handle(http.MethodDelete, "/:id<int>", app.errHandler(app.deletePlanHandler)).Name("plan.delete")
+		r.Handle(http.MethodPost, "/:id<int>/transition", app.errHandler(app.transitionPlanV2Handler)).Name("plan.transition")
+	})
+	app.allowCORS(r)
+	return r
+}
+
+// corsConfig lists the origins of the browser clients, CORS is off without any.
+type corsConfig struct {
+	origins []string
+	maxAge  time.Duration
+}
+
+// allowCORS lets the configured origins call the routes of r.
+func (app *application) allowCORS(r router.Router) {
+	if len(app.config.cors.origins) == 0 {
+		return
+	}
+
+	r.Wrap(router.CORS(router.CORSPolicy{
+		AllowedOrigins: app.config.cors.origins,
+		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", idempotencyHeader, requestIDHeader},
+		ExposedHeaders: []string{"Deprecation", "Link", "Sunset", replayedHeader, requestIDHeader},
+		MaxAge:         app.config.cors.maxAge,
+	}))
+}
+
+// limitBody limits the request bodies of the routes of r to the configured size.
+func (app *application) limitBody(r router.Router) {
+	if app.config.maxBody > 0 {
+		r.Wrap(app.bodyLimit(app.config.maxBody))
+	}
+}
+
+// bodyLimit limits request bodies to max bytes, answering 413 with a JSON error.
+func (app *application) bodyLimit(max int64) router.Middleware {
+	return router.BodyLimit(max, app.errorHandler(router.ErrBodyTooLarge))
+}
+
+// timeout answers 503 when a handler of r takes longer than the configured timeout.
+// Handlers panicking once answered are logged and counted like recovered panics.
+func (app *application) timeout(r router.Router) {
+	if app.config.handlerTimeout > 0 {
+		r.Wrap(router.Timeout(app.config.handlerTimeout, app.errorHandler(model.ErrTimeout), latePanic(app.log())))
+	}
+}
+
+// deprecate adds the deprecation headers to the responses of version, if deprecated.
+func (app *application) deprecate(r router.Router, version string) {
+	if dep, ok := app.config.deprecations[version]; ok {
+		r.Wrap(deprecated(dep))
+	}
+}
+
+// handler builds the dispatcher serving the application routes. Unknown paths and
+// methods are answered with JSON errors like any other handler error.
+func (app *application) handler() *apiHandler {
+	d := router.Build(app.routes()...)
+	d.NotFound(app.errorHandler(model.ErrNotFound))
+	d.MethodNotAllowed(app.errorHandler(model.ErrMethodNotAllowed))
+
+	// Run for every request before matching, unknown paths included, as versions
+	// are negotiated from the Accept header
+	var h http.Handler = d
+	h = negotiateVersion(h)
+	h = identifyClient(h)
+	if app.config.compressMin > 0 {
+		h = router.Compress(router.CompressOptions{MinSize: app.config.compressMin})(h)
+	}
+	h = recoverPanic(app.log(), app.config.repanic)(h)
+	h = requestID(h)
+
+	return &apiHandler{Dispatcher: d, handler: h}
+}
+
+// apiHandler is the dispatcher of the API behind the middleware of every request.
+type apiHandler struct {
+	router.Dispatcher
+	handler http.Handler
+}
+
+func (h *apiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.handler.ServeHTTP(w, r)
+}
+
+// printRoutes writes the route table, one route per line.
+func printRoutes(w io.Writer, routes []router.RouteInfo) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "METHOD\tPATTERN\tNAME\tMIDDLEWARE")
+	for _, rt := range routes {
+		method := rt.Method
+		if method == "" {
+			method = "*"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", method, rt.Pattern, rt.Name, strings.Join(rt.Middleware, ", "))
+	}
+
+	return tw.Flush()
+}
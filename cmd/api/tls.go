@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tlsConfig locates the server certificate, TLS is off without any. mTLS is on
+// when a client CA bundle is given.
+type tlsConfig struct {
+	certFile       string
+	keyFile        string
+	clientCAFile   string
+	minVersion     string
+	ciphers        string
+	reloadInterval time.Duration
+}
+
+func (c tlsConfig) enabled() bool {
+	return c.certFile != "" || c.keyFile != ""
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// parseCiphers returns the cipher suites of a comma separated list of names, nil
+// for the defaults of crypto/tls. Insecure suites are refused.
+func parseCiphers(names string) ([]uint16, error) {
+	if names == "" {
+		return nil, nil
+	}
+
+	suites := make(map[string]uint16)
+	for _, s := range tls.CipherSuites() {
+		suites[s.Name] = s.ID
+	}
+
+	var ids []uint16
+	for _, name := range strings.Split(names, ",") {
+		id, ok := suites[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// serverTLS returns the TLS configuration of the server, its certificate and client
+// CAs read from store. Cipher suites only apply up to TLS 1.2, TLS 1.3 ones are fixed.
+func (c tlsConfig) serverTLS(store *certStore) (*tls.Config, error) {
+	if c.certFile == "" || c.keyFile == "" {
+		return nil, errors.New("tls: both the certificate and key files are needed")
+	}
+
+	minVersion := tls.VersionTLS12
+	if c.minVersion != "" {
+		v, ok := tlsVersions[c.minVersion]
+		if !ok {
+			return nil, fmt.Errorf("tls: unknown version %q (1.0|1.1|1.2|1.3)", c.minVersion)
+		}
+		minVersion = int(v)
+	}
+
+	ciphers, err := parseCiphers(c.ciphers)
+	if err != nil {
+		return nil, fmt.Errorf("tls: %w", err)
+	}
+
+	cfg := &tls.Config{
+		MinVersion:     uint16(minVersion),
+		CipherSuites:   ciphers,
+		GetCertificate: store.certificate,
+	}
+	if c.clientCAFile == "" {
+		return cfg, nil
+	}
+
+	// Resolved per connection to pick up reloaded CAs
+	cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		client := cfg.Clone()
+		client.GetConfigForClient = nil
+		client.ClientCAs = store.clientCAs()
+		return client, nil
+	}
+
+	return cfg, nil
+}
+
+// certStore holds the server certificate and the client CA pool loaded from
+// files, reloaded when the files change.
+type certStore struct {
+	certFile, keyFile, caFile string
+	logger                    *log.Logger
+
+	mu    sync.RWMutex
+	cert  *tls.Certificate
+	cas   *x509.CertPool
+	stamp string
+}
+
+// newCertStore loads the files, caFile may be empty.
+func newCertStore(certFile, keyFile, caFile string, logger *log.Logger) (*certStore, error) {
+	s := &certStore{certFile: certFile, keyFile: keyFile, caFile: caFile, logger: logger}
+	if _, err := s.reload(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *certStore) certificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.cert, nil
+}
+
+func (s *certStore) clientCAs() *x509.CertPool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.cas
+}
+
+// reload loads the files again if any changed since the last load. On error the
+// loaded certificates are kept.
+func (s *certStore) reload() (bool, error) {
+	stamp, err := s.fileStamp()
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.RLock()
+	same := stamp == s.stamp
+	s.mu.RUnlock()
+	if same {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("tls: %w", err)
+	}
+
+	var cas *x509.CertPool
+	if s.caFile != "" {
+		pem, err := os.ReadFile(s.caFile)
+		if err != nil {
+			return false, fmt.Errorf("tls: %w", err)
+		}
+		cas = x509.NewCertPool()
+		if !cas.AppendCertsFromPEM(pem) {
+			return false, fmt.Errorf("tls: no certificate found in %s", s.caFile)
+		}
+	}
+
+	s.mu.Lock()
+	s.cert, s.cas, s.stamp = &cert, cas, stamp
+	s.mu.Unlock()
+
+	return true, nil
+}
+
+// fileStamp identifies the current version of the files by size and modification time.
+func (s *certStore) fileStamp() (string, error) {
+	var b strings.Builder
+	for _, name := range []string{s.certFile, s.keyFile, s.caFile} {
+		if name == "" {
+			continue
+		}
+
+		fi, err := os.Stat(name)
+		if err != nil {
+			return "", fmt.Errorf("tls: %w", err)
+		}
+		fmt.Fprintf(&b, "%s:%d:%d;", name, fi.Size(), fi.ModTime().UnixNano())
+	}
+
+	return b.String(), nil
+}
+
+// watch reloads the files every interval until ctx is done.
+func (s *certStore) watch(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			reloaded, err := s.reload()
+			switch {
+			case err != nil:
+				s.logger.Printf("keeping the loaded certificates: %v", err)
+			case reloaded:
+				s.logger.Printf("reloaded the certificates")
+			}
+		}
+	}
+}
+
+// clientIdentity is the client authenticated by its certificate with mTLS.
+type clientIdentity struct {
+	CommonName  string
+	DNSNames    []string
+	URIs        []string
+	Serial      string
+	Fingerprint string
+}
+
+type clientIdentityKey struct{}
+
+// identifyClient sets the identity of clients authenticated by certificate on
+// their requests, see clientIdentityOf.
+func identifyClient(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cert := r.TLS.VerifiedChains[0][0]
+		sum := sha256.Sum256(cert.Raw)
+		id := &clientIdentity{
+			CommonName:  cert.Subject.CommonName,
+			DNSNames:    cert.DNSNames,
+			Serial:      cert.SerialNumber.String(),
+			Fingerprint: hex.EncodeToString(sum[:]),
+		}
+		for _, u := range cert.URIs {
+			id.URIs = append(id.URIs, u.String())
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIdentityKey{}, id)))
+	})
+}
+
+// clientIdentityOf returns the identity of the client, nil without a verified certificate.
+func clientIdentityOf(r *http.Request) *clientIdentity {
+	id, _ := r.Context().Value(clientIdentityKey{}).(*clientIdentity)
+	return id
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/h4ckm03d/simpleplan/model"
+	"github.com/h4ckm03d/simpleplan/planio"
+)
+
+const (
+	// exportPageSize is the number of plans read from the repository per round trip.
+	exportPageSize = 100
+
+	// maxImportErrors limits the line errors kept in an import summary, the
+	// failed counter still covers every line.
+	maxImportErrors = 100
+
+	// maxImportBody is the largest import body, whatever the limit of other requests.
+	maxImportBody = 64 << 20
+)
+
+// importError is a failed line, with the status the single plan endpoints would answer.
+type importError struct {
+	Line   int    `json:"line"`
+	Status int    `json:"status"`
+	Error  string `json:"error"`
+}
+
+// importMapping links the id found in the input to the id given by the repository.
+type importMapping struct {
+	SourceID int `json:"source_id"`
+	ID       int `json:"id"`
+}
+
+type importResponse struct {
+	Imported int             `json:"imported"`
+	Failed   int             `json:"failed"`
+	Errors   []importError   `json:"errors"`
+	Remapped []importMapping `json:"remapped,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// transferFormat picks the format from the format query value, then from the
+// fallback (a content type), defaulting to JSON Lines.
+func transferFormat(r *http.Request, fallback string) (planio.Format, error) {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return planio.ParseFormat(f)
+	}
+
+	if f := planio.FormatOf(fallback); f != "" {
+		return f, nil
+	}
+
+	return planio.JSONL, nil
+}
+
+// exportPlanHandler streams every plan in the requested format.
+func (app *application) exportPlanHandler(w http.ResponseWriter, r *http.Request) error {
+	format, err := transferFormat(r, "")
+	if err != nil {
+		return err
+	}
+
+	enc, err := planio.NewEncoder(format, w)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", planio.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="plans.%s"`, format))
+
+	for page := 0; ; page++ {
+		plans, err := app.PlanRepo.GetAll(exportPageSize, page)
+		if err != nil {
+			return err
+		}
+
+		for _, plan := range plans {
+			if err := enc.Encode(plan); err != nil {
+				return err
+			}
+		}
+
+		if len(plans) < exportPageSize {
+			break
+		}
+	}
+
+	return enc.Close()
+}
+
+// importPlanHandler reads plans from the request body one record at a time.
+// With preserve=true ids and timestamps are kept as they are, otherwise every
+// plan gets a new id and the summary lists the mapping from the source ids.
+func (app *application) importPlanHandler(w http.ResponseWriter, r *http.Request) error {
+	format, err := transferFormat(r, r.Header.Get("Content-Type"))
+	if err != nil {
+		return err
+	}
+
+	preserve := false
+	if v := r.URL.Query().Get("preserve"); v != "" {
+		if preserve, err = strconv.ParseBool(v); err != nil {
+			return fmt.Errorf("preserve: invalid value %q", v)
+		}
+	}
+
+	defer dclose(r.Body)
+	dec, err := planio.NewDecoder(format, r.Body)
+	if err != nil {
+		return err
+	}
+
+	res := importResponse{Errors: []importError{}}
+	fail := func(line int, err error) {
+		res.Failed++
+		if len(res.Errors) < maxImportErrors {
+			res.Errors = append(res.Errors, importError{Line: line, Status: errorStatus(err), Error: err.Error()})
+		}
+	}
+
+	for {
+		plan, err := dec.Decode()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var lerr *planio.LineError
+		if errors.As(err, &lerr) {
+			fail(lerr.Line, lerr.Err)
+			continue
+		}
+		if err != nil {
+			// The rest of the input can't be read, report what was done so far
+			res.Error = err.Error()
+			w.WriteHeader(errorStatus(err))
+			return json.NewEncoder(w).Encode(res)
+		}
+
+		if err := app.importPlan(plan, preserve, &res); err != nil {
+			fail(dec.Line(), err)
+		}
+	}
+
+	return json.NewEncoder(w).Encode(res)
+}
+
+func (app *application) importPlan(plan *model.Plan, preserve bool, res *importResponse) error {
+	if preserve {
+		if _, err := app.PlanRepo.Restore(plan); err != nil {
+			return fmt.Errorf("id %d: %w", plan.ID, err)
+		}
+		res.Imported++
+		return nil
+	}
+
+	created, err := app.PlanRepo.Create(&model.Plan{Name: plan.Name, Description: plan.Description})
+	if err != nil {
+		return err
+	}
+
+	res.Imported++
+	if plan.ID != 0 {
+		res.Remapped = append(res.Remapped, importMapping{SourceID: plan.ID, ID: created.ID})
+	}
+
+	return nil
+}
@@ -3,6 +3,9 @@ package main
 import (
 	"io"
 	"log"
+	"net/http"
+
+	"github.com/h4ckm03d/simpleplan/codec"
 )
 
 // dclose closer with err check
@@ -11,3 +14,19 @@ func dclose(c io.Closer) {
 		log.Fatal(err)
 	}
 }
+
+// errorResponse is the body of every error answered by the API.
+type errorResponse struct {
+	Error string `json:"error" xml:"error"`
+}
+
+// writeError answers status with err as an error body, in the codec negotiated for
+// r. Errors answered before negotiation, such as 406 and 415, are JSON.
+func writeError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	c := codecs(r).res
+	w.Header().Set("Content-Type", codec.MediaType(c))
+	w.WriteHeader(status)
+	if err := c.Encode(w, errorResponse{Error: err.Error()}); err != nil {
+		log.Println(err)
+	}
+}
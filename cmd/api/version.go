@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/h4ckm03d/simpleplan/router"
+)
+
+// API versions, oldest first. Requests without a version prefix in their path get
+// the version named by their Accept header, defaultVersion otherwise.
+var apiVersions = []string{"v1", "v2"}
+
+const defaultVersion = "v1"
+
+var (
+	// versionMediaType matches the vendor media type naming an API version.
+	versionMediaType = regexp.MustCompile(`application/vnd\.simpleplan\.(v[0-9]+)\+json`)
+
+	errUnknownVersion = errors.New("unknown API version")
+)
+
+// mediaType returns the vendor media type of an API version.
+func mediaType(version string) string {
+	return "application/vnd.simpleplan." + version + "+json"
+}
+
+func knownVersion(version string) bool {
+	for _, v := range apiVersions {
+		if v == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pathVersion returns the version prefix of p, "" if p has none.
+func pathVersion(p string) string {
+	v := strings.TrimPrefix(p, "/")
+	if i := strings.IndexByte(v, '/'); i >= 0 {
+		v = v[:i]
+	}
+	if knownVersion(v) {
+		return v
+	}
+
+	return ""
+}
+
+// negotiateVersion routes requests without a version prefix to the version named
+// in their Accept header. A version in the path always wins over the header.
+func negotiateVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if pathVersion(r.URL.Path) != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept")
+		version := defaultVersion
+		if m := versionMediaType.FindStringSubmatch(r.Header.Get("Accept")); m != nil {
+			if !knownVersion(m[1]) {
+				writeError(w, r, http.StatusNotAcceptable, fmt.Errorf("%w %q", errUnknownVersion, m[1]))
+				return
+			}
+			version = m[1]
+		}
+
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = "/" + version + r.URL.Path
+		if r.URL.RawPath != "" {
+			r2.URL.RawPath = "/" + version + r.URL.RawPath
+		}
+		next.ServeHTTP(w, r2)
+	})
+}
+
+// deprecation dates of an API version, the sunset is optional.
+type deprecation struct {
+	at     time.Time
+	sunset time.Time
+}
+
+// deprecations holds the deprecated API versions, set with -deprecate flags
+// such as "v1:2026-10-01:2027-04-01".
+type deprecations map[string]deprecation
+
+func (d deprecations) String() string {
+	parts := make([]string, 0, len(d))
+	for v, dep := range d {
+		s := v + ":" + dep.at.Format("2006-01-02")
+		if !dep.sunset.IsZero() {
+			s += ":" + dep.sunset.Format("2006-01-02")
+		}
+		parts = append(parts, s)
+	}
+	sort.Strings(parts)
+
+	return strings.Join(parts, ",")
+}
+
+func (d deprecations) Set(s string) error {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return fmt.Errorf("invalid deprecation %q (version:date[:sunset])", s)
+	}
+	if !knownVersion(parts[0]) {
+		return fmt.Errorf("%w %q", errUnknownVersion, parts[0])
+	}
+
+	var dep deprecation
+	var err error
+	if dep.at, err = time.Parse("2006-01-02", parts[1]); err != nil {
+		return err
+	}
+	if len(parts) == 3 {
+		if dep.sunset, err = time.Parse("2006-01-02", parts[2]); err != nil {
+			return err
+		}
+	}
+	d[parts[0]] = dep
+
+	return nil
+}
+
+// deprecated adds the Deprecation (RFC 9745) and Sunset (RFC 8594) headers to the
+// responses of a deprecated version, with a link to the latest version.
+func deprecated(dep deprecation) router.Middleware {
+	value := "@" + strconv.FormatInt(dep.at.Unix(), 10)
+	successor := fmt.Sprintf(`</%s>; rel="successor-version"`, apiVersions[len(apiVersions)-1])
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", value)
+			if !dep.sunset.IsZero() {
+				w.Header().Set("Sunset", dep.sunset.UTC().Format(http.TimeFormat))
+			}
+			w.Header().Add("Link", successor)
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/h4ckm03d/simpleplan/model"
+	"github.com/h4ckm03d/simpleplan/planio"
+)
+
+// client talks to the plan API described by a profile.
+type client struct {
+	profile profile
+	http    *http.Client
+}
+
+func newClient(p profile) *client {
+	return &client{
+		profile: p,
+		// No overall timeout, imports and exports stream for as long as the server
+		// read and write timeouts allow (-read-timeout and -write-timeout)
+		http: &http.Client{Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 5 * time.Minute,
+		}},
+	}
+}
+
+// apiError is returned for any non 2xx response.
+type apiError struct {
+	Status  int
+	Message string
+}
+
+func (e *apiError) Error() string {
+	if e.Message == "" {
+		return http.StatusText(e.Status)
+	}
+
+	return fmt.Sprintf("%s: %s", http.StatusText(e.Status), e.Message)
+}
+
+// do sends a request to the API and decodes the JSON response into out when not nil.
+func (c *client) do(method, path string, query url.Values, in, out any) (err error) {
+	var body io.Reader
+	var contentType string
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+		contentType = "application/json"
+	}
+
+	res, err := c.send(method, path, query, contentType, body)
+	if err != nil {
+		return err
+	}
+	defer closeWith(res.Body, &err)
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// send sends a request to the API and returns the response of a successful call,
+// the caller must close the response body.
+func (c *client) send(method, path string, query url.Values, contentType string, body io.Reader) (*http.Response, error) {
+	u := strings.TrimRight(c.profile.Server, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	c.authorize(req)
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode >= http.StatusBadRequest {
+		err := readError(res)
+		closeWith(res.Body, &err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// authorize sets the profile credentials on the request.
+func (c *client) authorize(req *http.Request) {
+	switch {
+	case c.profile.Token != "":
+		req.Header.Set("Authorization", "Bearer "+c.profile.Token)
+	case c.profile.Username != "":
+		req.SetBasicAuth(c.profile.Username, c.profile.Password)
+	}
+}
+
+// readError builds an apiError, using the JSON error message from the body when present.
+func readError(res *http.Response) error {
+	e := &apiError{Status: res.StatusCode}
+
+	var msg struct {
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<16)).Decode(&msg); err == nil {
+		e.Message = msg.Error
+	}
+
+	return e
+}
+
+func (c *client) List(limit, page int) ([]*model.Plan, error) {
+	q := url.Values{}
+	q.Set("limit", strconv.Itoa(limit))
+	q.Set("page", strconv.Itoa(page))
+
+	var plans []*model.Plan
+	if err := c.do(http.MethodGet, "/v1/plan", q, nil, &plans); err != nil {
+		return nil, err
+	}
+
+	return plans, nil
+}
+
+func (c *client) Get(id int) (*model.Plan, error) {
+	var plan model.Plan
+	if err := c.do(http.MethodGet, "/v1/plan/"+strconv.Itoa(id), nil, nil, &plan); err != nil {
+		return nil, err
+	}
+
+	return &plan, nil
+}
+
+func (c *client) Create(plan *model.Plan) (*model.Plan, error) {
+	var created model.Plan
+	if err := c.do(http.MethodPost, "/v1/plan", nil, plan, &created); err != nil {
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+func (c *client) Update(plan *model.Plan) (*model.Plan, error) {
+	var updated model.Plan
+	if err := c.do(http.MethodPut, "/v1/plan/"+strconv.Itoa(plan.ID), nil, plan, &updated); err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+func (c *client) Delete(id int) error {
+	return c.do(http.MethodDelete, "/v1/plan/"+strconv.Itoa(id), nil, nil, nil)
+}
+
+// Export streams every plan in the given format into w.
+func (c *client) Export(format planio.Format, w io.Writer) (err error) {
+	res, err := c.send(http.MethodGet, "/v1/plan/export", url.Values{"format": {string(format)}}, "", nil)
+	if err != nil {
+		return err
+	}
+	defer closeWith(res.Body, &err)
+
+	_, err = io.Copy(w, res.Body)
+	return err
+}
+
+// importSummary mirrors the response of the import endpoint.
+type importSummary struct {
+	Imported int `json:"imported" yaml:"imported"`
+	Failed   int `json:"failed" yaml:"failed"`
+	Errors   []struct {
+		Line   int    `json:"line" yaml:"line"`
+		Status int    `json:"status" yaml:"status"`
+		Error  string `json:"error" yaml:"error"`
+	} `json:"errors" yaml:"errors"`
+	Remapped []struct {
+		SourceID int `json:"source_id" yaml:"source_id"`
+		ID       int `json:"id" yaml:"id"`
+	} `json:"remapped,omitempty" yaml:"remapped,omitempty"`
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// Import streams r to the server, keeping ids and timestamps when preserve is set.
+func (c *client) Import(format planio.Format, r io.Reader, preserve bool) (_ *importSummary, err error) {
+	q := url.Values{"format": {string(format)}}
+	if preserve {
+		q.Set("preserve", "true")
+	}
+
+	// The transport closes request bodies, r belongs to the caller so hide its Close
+	res, err := c.send(http.MethodPost, "/v1/plan/import", q, planio.ContentType(format), io.NopCloser(r))
+	if err != nil {
+		return nil, err
+	}
+	defer closeWith(res.Body, &err)
+
+	var summary importSummary
+	if err := json.NewDecoder(res.Body).Decode(&summary); err != nil {
+		return nil, err
+	}
+
+	return &summary, nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/h4ckm03d/simpleplan/model"
+	"github.com/h4ckm03d/simpleplan/planio"
+)
+
+// pageSize is the biggest page the API serves.
+const pageSize = 100
+
+func newFlagSet(e *env, name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	return fs
+}
+
+// idArg parses the single plan id argument of get, update and delete.
+func idArg(fs *flag.FlagSet) (int, error) {
+	if fs.NArg() != 1 {
+		return 0, fmt.Errorf("%s: expected exactly one plan id", fs.Name())
+	}
+
+	id, err := strconv.Atoi(fs.Arg(0))
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid plan id %q", fs.Name(), fs.Arg(0))
+	}
+
+	return id, nil
+}
+
+func listCmd(e *env, args []string) error {
+	fs := newFlagSet(e, "list")
+	limit := fs.Int("limit", 10, "Page size (max 100)")
+	page := fs.Int("page", 0, "Page number, starting at 0")
+	all := fs.Bool("all", false, "Fetch every page")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *all {
+		plans, err := fetchAll(e.client)
+		if err != nil {
+			return err
+		}
+		return e.print(e.stdout, plans, false)
+	}
+
+	plans, err := e.client.List(*limit, *page)
+	if err != nil {
+		return err
+	}
+
+	return e.print(e.stdout, plans, false)
+}
+
+func getCmd(e *env, args []string) error {
+	fs := newFlagSet(e, "get")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	id, err := idArg(fs)
+	if err != nil {
+		return err
+	}
+
+	plan, err := e.client.Get(id)
+	if err != nil {
+		return err
+	}
+
+	return e.print(e.stdout, []*model.Plan{plan}, true)
+}
+
+func createCmd(e *env, args []string) error {
+	fs := newFlagSet(e, "create")
+	name := fs.String("name", "", "Plan name")
+	description := fs.String("description", "", "Plan description")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *name == "" {
+		return errors.New("create: -name is required")
+	}
+
+	plan, err := e.client.Create(&model.Plan{Name: *name, Description: *description})
+	if err != nil {
+		return err
+	}
+
+	return e.print(e.stdout, []*model.Plan{plan}, true)
+}
+
+func updateCmd(e *env, args []string) error {
+	fs := newFlagSet(e, "update")
+	name := fs.String("name", "", "New plan name")
+	description := fs.String("description", "", "New plan description")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	id, err := idArg(fs)
+	if err != nil {
+		return err
+	}
+
+	// The API replaces the whole plan, so start from the stored one and
+	// only change the fields given on the command line.
+	plan, err := e.client.Get(id)
+	if err != nil {
+		return err
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "name":
+			plan.Name = *name
+		case "description":
+			plan.Description = *description
+		}
+	})
+
+	plan, err = e.client.Update(plan)
+	if err != nil {
+		return err
+	}
+
+	return e.print(e.stdout, []*model.Plan{plan}, true)
+}
+
+func deleteCmd(e *env, args []string) error {
+	fs := newFlagSet(e, "delete")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	id, err := idArg(fs)
+	if err != nil {
+		return err
+	}
+
+	return e.client.Delete(id)
+}
+
+// transferFormat returns the format given with -format, or the one matching the
+// file extension, defaulting to JSON Lines.
+func transferFormat(format, file string) (planio.Format, error) {
+	if format != "" {
+		return planio.ParseFormat(format)
+	}
+
+	if f := planio.FormatOf(file); f != "" {
+		return f, nil
+	}
+
+	return planio.JSONL, nil
+}
+
+func importCmd(e *env, args []string) (err error) {
+	fs := newFlagSet(e, "import")
+	file := fs.String("f", "-", "Input file (- for stdin)")
+	format := fs.String("format", "", "Input format jsonl|csv|yaml (default: from file extension, else jsonl)")
+	preserve := fs.Bool("preserve", false, "Keep ids and timestamps instead of assigning new ids")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	f, err := transferFormat(*format, *file)
+	if err != nil {
+		return err
+	}
+
+	in := e.stdin
+	if *file != "-" {
+		var fd *os.File
+		if fd, err = os.Open(*file); err != nil {
+			return err
+		}
+		defer closeWith(fd, &err)
+		in = fd
+	}
+
+	summary, err := e.client.Import(f, in, *preserve)
+	if err != nil {
+		return err
+	}
+
+	if err := e.printValue(summary); err != nil {
+		return err
+	}
+
+	if summary.Failed > 0 {
+		return fmt.Errorf("import: %d of %d plans failed", summary.Failed, summary.Failed+summary.Imported)
+	}
+
+	return nil
+}
+
+func exportCmd(e *env, args []string) (err error) {
+	fs := newFlagSet(e, "export")
+	file := fs.String("f", "-", "Output file (- for stdout)")
+	format := fs.String("format", "", "Output format jsonl|csv|yaml (default: from file extension, else jsonl)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	f, err := transferFormat(*format, *file)
+	if err != nil {
+		return err
+	}
+
+	if *file == "-" {
+		return e.client.Export(f, e.stdout)
+	}
+
+	fd, err := os.Create(*file)
+	if err != nil {
+		return err
+	}
+	defer closeWith(fd, &err)
+
+	return e.client.Export(f, fd)
+}
+
+// fetchAll pages through the list endpoint until the server runs out of plans.
+func fetchAll(c *client) ([]*model.Plan, error) {
+	var plans []*model.Plan
+	for page := 0; ; page++ {
+		batch, err := c.List(pageSize, page)
+		if err != nil {
+			return nil, err
+		}
+
+		plans = append(plans, batch...)
+		if len(batch) < pageSize {
+			return plans, nil
+		}
+	}
+}
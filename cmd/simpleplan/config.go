@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+const defaultServer = "http://localhost:4000"
+
+// profile holds the connection settings for one API server.
+type profile struct {
+	Server   string `yaml:"server"`
+	Token    string `yaml:"token,omitempty"`
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+}
+
+// config is the content of the CLI configuration file, e.g.:
+//
+//	current: staging
+//	profiles:
+//	  staging:
+//	    server: https://plan.staging.local
+//	    token: s3cr3t
+type config struct {
+	Current  string             `yaml:"current"`
+	Profiles map[string]profile `yaml:"profiles"`
+}
+
+// defaultConfigPath returns the config file location, honouring SIMPLEPLAN_CONFIG.
+func defaultConfigPath() string {
+	if p := os.Getenv("SIMPLEPLAN_CONFIG"); p != "" {
+		return p
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "simpleplan", "config.yaml")
+}
+
+// loadConfig reads the config file. A missing file is not an error, the CLI then
+// falls back to a single "default" profile pointing to a local server.
+func loadConfig(path string) (*config, error) {
+	cfg := &config{
+		Current:  "default",
+		Profiles: map[string]profile{"default": {Server: defaultServer}},
+	}
+
+	if path == "" {
+		return cfg, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(b, cfg); err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// profile returns the named profile, or the current one if name is empty.
+func (c *config) profile(name string) (profile, error) {
+	if name == "" {
+		name = c.Current
+	}
+
+	p, ok := c.Profiles[name]
+	if !ok {
+		return profile{}, fmt.Errorf("unknown profile %q", name)
+	}
+
+	if p.Server == "" {
+		p.Server = defaultServer
+	}
+
+	return p, nil
+}
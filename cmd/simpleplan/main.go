@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+const usage = `Usage: simpleplan [flags] <command> [command flags] [args]
+
+Commands:
+%s
+Flags:
+`
+
+// env bundles everything a command needs to run.
+type env struct {
+	client *client
+	print  printer
+	format string
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// command is a CLI subcommand. run receives the arguments following the command name.
+type command struct {
+	summary string
+	run     func(e *env, args []string) error
+}
+
+var commands = map[string]command{
+	"list":   {"List plans", listCmd},
+	"get":    {"Show a plan by id", getCmd},
+	"create": {"Create a plan", createCmd},
+	"update": {"Update a plan by id", updateCmd},
+	"delete": {"Delete a plan by id", deleteCmd},
+	"import": {"Import plans from a JSON Lines, CSV or YAML file", importCmd},
+	"export": {"Export all plans as JSON Lines, CSV or YAML", exportCmd},
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "simpleplan:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("simpleplan", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, usage, commandList())
+		fs.PrintDefaults()
+	}
+
+	configPath := fs.String("config", defaultConfigPath(), "Config file `path`")
+	profileName := fs.String("profile", os.Getenv("SIMPLEPLAN_PROFILE"), "Config profile `name` (default: current profile)")
+	server := fs.String("server", "", "API server `url`, overrides the profile")
+	output := fs.String("o", "table", "Output `format` (table|json|yaml)")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fs.Usage()
+		return fmt.Errorf("unknown command %q", fs.Arg(0))
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+
+	p, err := cfg.profile(*profileName)
+	if err != nil {
+		return err
+	}
+
+	if *server != "" {
+		p.Server = *server
+	}
+
+	printFn, err := newPrinter(*output)
+	if err != nil {
+		return err
+	}
+
+	return cmd.run(&env{
+		client: newClient(p),
+		print:  printFn,
+		format: *output,
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+	}, fs.Args()[1:])
+}
+
+// commandList renders the commands help section.
+func commandList() string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var s string
+	for _, name := range names {
+		s += fmt.Sprintf("  %-8s %s\n", name, commands[name].summary)
+	}
+
+	return s
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/h4ckm03d/simpleplan/model"
+	"github.com/h4ckm03d/simpleplan/planio"
+	"github.com/h4ckm03d/simpleplan/repo"
+	"github.com/h4ckm03d/simpleplan/router"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeAPI serves the plan endpoints the CLI uses and records the last Authorization header.
+func fakeAPI(t *testing.T) (*httptest.Server, *string) {
+	t.Helper()
+	plans := repo.NewPlanRepo(nil)
+	auth := new(string)
+
+	r := router.New("/v1")
+	r.Add("/plan", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		*auth = req.Header.Get("Authorization")
+		switch req.Method {
+		case http.MethodGet:
+			limit, _ := strconv.Atoi(req.URL.Query().Get("limit"))
+			page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+			data, _ := plans.GetAll(limit, page)
+			json.NewEncoder(w).Encode(data)
+		case http.MethodPost:
+			var p model.Plan
+			json.NewDecoder(req.Body).Decode(&p)
+			data, _ := plans.Create(&p)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(data)
+		}
+	}))
+	r.Add("/plan/export", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		format, _ := planio.ParseFormat(req.URL.Query().Get("format"))
+		enc, _ := planio.NewEncoder(format, w)
+		data, _ := plans.GetAll(100, 0)
+		for _, p := range data {
+			enc.Encode(p)
+		}
+		enc.Close()
+	}))
+	r.Add("/plan/import", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		format, _ := planio.ParseFormat(req.URL.Query().Get("format"))
+		dec, _ := planio.NewDecoder(format, req.Body)
+		res := map[string]any{"imported": 0, "failed": 0}
+		for {
+			p, err := dec.Decode()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				res["failed"] = res["failed"].(int) + 1
+				continue
+			}
+			if req.URL.Query().Get("preserve") == "true" {
+				plans.Restore(p)
+			} else {
+				plans.Create(p)
+			}
+			res["imported"] = res["imported"].(int) + 1
+		}
+		json.NewEncoder(w).Encode(res)
+	}))
+	r.Add("/plan/:id", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id, _ := strconv.Atoi(router.Param(req, "id"))
+		var err error
+		var data *model.Plan
+		switch req.Method {
+		case http.MethodGet:
+			data, err = plans.Get(id)
+		case http.MethodPut:
+			var p model.Plan
+			json.NewDecoder(req.Body).Decode(&p)
+			p.ID = id
+			data, err = plans.Update(&p)
+		case http.MethodDelete:
+			err = plans.Delete(id)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		if data != nil {
+			json.NewEncoder(w).Encode(data)
+		}
+	}))
+
+	srv := httptest.NewServer(router.Build(r))
+	t.Cleanup(srv.Close)
+
+	return srv, auth
+}
+
+func runCLI(t *testing.T, srv *httptest.Server, stdin string, args ...string) (string, error) {
+	t.Helper()
+	out := new(bytes.Buffer)
+	args = append([]string{"-config", "", "-server", srv.URL}, args...)
+	err := run(args, strings.NewReader(stdin), out, new(bytes.Buffer))
+	return out.String(), err
+}
+
+func TestCommands(t *testing.T) {
+	srv, _ := fakeAPI(t)
+
+	out, err := runCLI(t, srv, "", "-o", "json", "create", "-name", "Plan A", "-description", "first")
+	assert.NoError(t, err)
+	var created model.Plan
+	assert.NoError(t, json.Unmarshal([]byte(out), &created))
+	assert.Equal(t, 1, created.ID)
+	assert.Equal(t, "Plan A", created.Name)
+
+	_, err = runCLI(t, srv, "", "update", "-name", "Plan B", "1")
+	assert.NoError(t, err)
+
+	out, err = runCLI(t, srv, "", "-o", "yaml", "get", "1")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "name: Plan B")
+	assert.Contains(t, out, "description: first")
+
+	out, err = runCLI(t, srv, "", "list")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "ID")
+	assert.Contains(t, out, "Plan B")
+
+	_, err = runCLI(t, srv, "", "delete", "1")
+	assert.NoError(t, err)
+
+	_, err = runCLI(t, srv, "", "get", "1")
+	assert.EqualError(t, err, "Not Found: not found")
+
+	_, err = runCLI(t, srv, "", "get", "one")
+	assert.Error(t, err)
+
+	_, err = runCLI(t, srv, "", "unknown")
+	assert.Error(t, err)
+}
+
+func TestImportExport(t *testing.T) {
+	srv, _ := fakeAPI(t)
+
+	out, err := runCLI(t, srv, "{\"id\":4,\"name\":\"one\"}\n{\"id\":9,\"name\":\"two\"}\n", "-o", "json", "import", "-preserve")
+	assert.NoError(t, err)
+	assert.Contains(t, out, `"imported": 2`)
+
+	file := filepath.Join(t.TempDir(), "plans.csv")
+	_, err = runCLI(t, srv, "", "export", "-f", file)
+	assert.NoError(t, err)
+
+	b, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(b), "id,name,description,status,created_at,updated_at\n4,one,,draft,"))
+	assert.Contains(t, string(b), "\n9,two,")
+
+	_, err = runCLI(t, srv, "", "import", "-f", file)
+	assert.NoError(t, err)
+
+	out, err = runCLI(t, srv, "", "export", "-format", "yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, strings.Count(out, "name: "))
+	assert.Contains(t, out, "id: 11")
+
+	_, err = runCLI(t, srv, "", "export", "-format", "xml")
+	assert.Error(t, err)
+}
+
+func TestProfile(t *testing.T) {
+	srv, auth := fakeAPI(t)
+
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(file, []byte(`current: local
+profiles:
+  local:
+    server: `+srv.URL+`
+    token: s3cr3t
+  broken:
+    server: http://127.0.0.1:1
+`), 0o600)
+	assert.NoError(t, err)
+
+	err = run([]string{"-config", file, "list"}, nil, new(bytes.Buffer), new(bytes.Buffer))
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer s3cr3t", *auth)
+
+	err = run([]string{"-config", file, "-profile", "missing", "list"}, nil, new(bytes.Buffer), new(bytes.Buffer))
+	assert.EqualError(t, err, `unknown profile "missing"`)
+}
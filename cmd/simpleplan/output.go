@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/h4ckm03d/simpleplan/model"
+	"gopkg.in/yaml.v3"
+)
+
+// printer writes plans in one of the supported output formats.
+type printer func(w io.Writer, plans []*model.Plan, single bool) error
+
+var printers = map[string]printer{
+	"table": printTable,
+	"json":  printJSON,
+	"yaml":  printYAML,
+}
+
+func newPrinter(format string) (printer, error) {
+	p, ok := printers[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown output format %q (table|json|yaml)", format)
+	}
+
+	return p, nil
+}
+
+// printValue writes any value as JSON or YAML, the table format falls back to YAML.
+func (e *env) printValue(v any) (err error) {
+	if e.format == "json" {
+		enc := json.NewEncoder(e.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	enc := yaml.NewEncoder(e.stdout)
+	defer closeWith(enc, &err)
+	return enc.Encode(v)
+}
+
+func printTable(w io.Writer, plans []*model.Plan, _ bool) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tDESCRIPTION\tCREATED\tUPDATED")
+	for _, p := range plans {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			strconv.Itoa(p.ID),
+			p.Name,
+			p.Description,
+			p.CreatedAt.Format(time.RFC3339),
+			p.UpdatedAt.Format(time.RFC3339),
+		)
+	}
+
+	return tw.Flush()
+}
+
+func printJSON(w io.Writer, plans []*model.Plan, single bool) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if single && len(plans) == 1 {
+		return enc.Encode(plans[0])
+	}
+
+	return enc.Encode(plans)
+}
+
+func printYAML(w io.Writer, plans []*model.Plan, single bool) (err error) {
+	enc := yaml.NewEncoder(w)
+	defer closeWith(enc, &err)
+	if single && len(plans) == 1 {
+		return enc.Encode(plans[0])
+	}
+
+	return enc.Encode(plans)
+}
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"io"
+)
+
+// closeWith closes c, reporting the close error through err unless it already
+// holds one. Closing files and encoders flushes them, so it may fail like a write.
+func closeWith(c io.Closer, err *error) {
+	if cerr := c.Close(); cerr != nil && *err == nil {
+		*err = cerr
+	}
+}
@@ -0,0 +1,25 @@
+package codec
+
+import (
+	"io"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// cborEncMode writes times as RFC 3339 strings, keeping their precision.
+var cborEncMode, _ = cbor.EncOptions{Time: cbor.TimeRFC3339Nano}.EncMode()
+
+// CBOR is the CBOR codec. Fields are named by their json tags, unless they have a cbor one.
+type CBOR struct{}
+
+func (CBOR) MediaTypes() []string {
+	return []string{"application/cbor"}
+}
+
+func (CBOR) Encode(w io.Writer, v interface{}) error {
+	return cborEncMode.NewEncoder(w).Encode(v)
+}
+
+func (CBOR) Decode(r io.Reader, v interface{}) error {
+	return cbor.NewDecoder(r).Decode(v)
+}
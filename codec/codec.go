@@ -0,0 +1,176 @@
+// Package codec encodes and decodes HTTP bodies in the wire formats negotiated
+// with the Content-Type and Accept headers.
+package codec
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrUnsupportedMediaType is returned for a request body of a type without codec.
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+	// ErrNotAcceptable is returned when no codec matches the Accept header.
+	ErrNotAcceptable = errors.New("not acceptable")
+)
+
+// Codec encodes and decodes values in a wire format.
+type Codec interface {
+	// MediaTypes returns the media types of the format, the first one is written
+	// in the Content-Type of encoded bodies. Its subtype also stands for the
+	// structured syntax suffix of the format, e.g. "+json" for "application/json".
+	MediaTypes() []string
+
+	Encode(w io.Writer, v interface{}) error
+	Decode(r io.Reader, v interface{}) error
+}
+
+// MediaType returns the media type written by c.
+func MediaType(c Codec) string {
+	return c.MediaTypes()[0]
+}
+
+// Registry selects codecs by media type. The first registered codec is the default.
+type Registry struct {
+	codecs []Codec
+}
+
+// NewRegistry returns a registry of codecs, in order of preference.
+func NewRegistry(codecs ...Codec) *Registry {
+	r := &Registry{}
+	for _, c := range codecs {
+		r.Register(c)
+	}
+
+	return r
+}
+
+// Default returns a registry with JSON, the default, XML, MessagePack and CBOR.
+func Default() *Registry {
+	return NewRegistry(JSON{}, XML{}, MessagePack{}, CBOR{})
+}
+
+// Register adds c with the lowest preference.
+func (r *Registry) Register(c Codec) {
+	r.codecs = append(r.codecs, c)
+}
+
+// Lookup returns the codec of a media type without parameters, matching its
+// structured syntax suffix if no codec has the type, nil if none does.
+func (r *Registry) Lookup(mediaType string) Codec {
+	mediaType = strings.ToLower(mediaType)
+	for _, c := range r.codecs {
+		for _, t := range c.MediaTypes() {
+			if t == mediaType {
+				return c
+			}
+		}
+	}
+
+	if i := strings.LastIndexByte(mediaType, '+'); i >= 0 {
+		suffix := mediaType[i+1:]
+		for _, c := range r.codecs {
+			if subtype(MediaType(c)) == suffix {
+				return c
+			}
+		}
+	}
+
+	return nil
+}
+
+// ForContentType returns the codec decoding a body of contentType, the default
+// codec for an empty one.
+func (r *Registry) ForContentType(contentType string) (Codec, error) {
+	if contentType == "" {
+		return r.codecs[0], nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, ErrUnsupportedMediaType
+	}
+
+	if c := r.Lookup(mediaType); c != nil {
+		return c, nil
+	}
+
+	return nil, ErrUnsupportedMediaType
+}
+
+// Negotiate returns the preferred codec accepted by an Accept header value,
+// the default codec for an empty one. Wildcards such as "*/*" and "application/*"
+// pick the registered codecs in order.
+func (r *Registry) Negotiate(accept string) (Codec, error) {
+	if strings.TrimSpace(accept) == "" {
+		return r.codecs[0], nil
+	}
+
+	for _, mediaType := range acceptedTypes(accept) {
+		switch {
+		case mediaType == "*/*":
+			return r.codecs[0], nil
+		case strings.HasSuffix(mediaType, "/*"):
+			for _, c := range r.codecs {
+				for _, t := range c.MediaTypes() {
+					if strings.HasPrefix(t, mediaType[:len(mediaType)-1]) {
+						return c, nil
+					}
+				}
+			}
+		default:
+			if c := r.Lookup(mediaType); c != nil {
+				return c, nil
+			}
+		}
+	}
+
+	return nil, ErrNotAcceptable
+}
+
+// acceptedTypes returns the media types of an Accept header value, by decreasing
+// quality, without the refused ones (q=0).
+func acceptedTypes(accept string) []string {
+	type accepted struct {
+		mediaType string
+		q         float64
+	}
+
+	types := make([]accepted, 0)
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			types = append(types, accepted{mediaType: mediaType, q: q})
+		}
+	}
+
+	sort.SliceStable(types, func(i, j int) bool {
+		return types[i].q > types[j].q
+	})
+
+	mediaTypes := make([]string, len(types))
+	for i, t := range types {
+		mediaTypes[i] = t.mediaType
+	}
+
+	return mediaTypes
+}
+
+func subtype(mediaType string) string {
+	return mediaType[strings.IndexByte(mediaType, '/')+1:]
+}
@@ -0,0 +1,143 @@
+package codec_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/h4ckm03d/simpleplan/codec"
+	"github.com/h4ckm03d/simpleplan/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoundTrip(t *testing.T) {
+	now := time.Date(2022, 6, 1, 10, 30, 0, 123, time.UTC)
+	plan := &model.Plan{ID: 7, Name: "Plan <a>", Description: "d", CreatedAt: now, UpdatedAt: now}
+
+	for _, c := range []codec.Codec{codec.JSON{}, codec.XML{}, codec.MessagePack{}, codec.CBOR{}} {
+		buf := new(bytes.Buffer)
+		assert.NoError(t, c.Encode(buf, plan), codec.MediaType(c))
+
+		var got model.Plan
+		assert.NoError(t, c.Decode(buf, &got), codec.MediaType(c))
+		assert.Equal(t, plan.ID, got.ID, codec.MediaType(c))
+		assert.Equal(t, plan.Name, got.Name, codec.MediaType(c))
+		assert.True(t, plan.CreatedAt.Equal(got.CreatedAt), codec.MediaType(c))
+	}
+
+	// Field names follow the json tags
+	buf := new(bytes.Buffer)
+	assert.NoError(t, codec.MessagePack{}.Encode(buf, plan))
+	assert.Contains(t, buf.String(), "created_at")
+	buf.Reset()
+	assert.NoError(t, codec.CBOR{}.Encode(buf, plan))
+	assert.Contains(t, buf.String(), "created_at")
+	buf.Reset()
+	assert.NoError(t, codec.XML{}.Encode(buf, plan))
+	assert.Contains(t, buf.String(), "<created_at>")
+}
+
+func TestXMLList(t *testing.T) {
+	plans := []*model.Plan{{ID: 1, Name: "a"}, {ID: 2, Name: "b"}}
+
+	buf := new(bytes.Buffer)
+	assert.NoError(t, codec.XML{}.Encode(buf, plans))
+	assert.Contains(t, buf.String(), "<plans><plan><id>1</id>")
+	assert.True(t, strings.HasSuffix(buf.String(), "</plan></plans>"))
+
+	var got []*model.Plan
+	assert.NoError(t, codec.XML{}.Decode(buf, &got))
+	assert.Len(t, got, 2)
+	assert.Equal(t, "b", got[1].Name)
+
+	// An empty list still has a root element
+	buf.Reset()
+	assert.NoError(t, codec.XML{}.Encode(buf, []model.Plan{}))
+	assert.Equal(t, xml.Header+"<plans></plans>", buf.String())
+	got = nil
+	assert.NoError(t, codec.XML{}.Decode(buf, &got))
+	assert.Empty(t, got)
+}
+
+func TestForContentType(t *testing.T) {
+	r := codec.Default()
+	for contentType, want := range map[string]codec.Codec{
+		"":                                   codec.JSON{},
+		"application/json; charset=utf-8":    codec.JSON{},
+		"TEXT/XML":                           codec.XML{},
+		"application/x-msgpack":              codec.MessagePack{},
+		"application/cbor":                   codec.CBOR{},
+		"application/vnd.simpleplan.v2+json": codec.JSON{},
+		"application/problem+xml":            codec.XML{},
+	} {
+		c, err := r.ForContentType(contentType)
+		assert.NoError(t, err, contentType)
+		assert.Equal(t, want, c, contentType)
+	}
+
+	for _, contentType := range []string{"text/plain", "application/x-www-form-urlencoded", "invalid;;"} {
+		_, err := r.ForContentType(contentType)
+		assert.ErrorIs(t, err, codec.ErrUnsupportedMediaType, contentType)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	r := codec.Default()
+	for accept, want := range map[string]codec.Codec{
+		"":                codec.JSON{},
+		"*/*":             codec.JSON{},
+		"application/*":   codec.JSON{},
+		"text/*":          codec.XML{},
+		"application/xml": codec.XML{},
+		"text/html, application/cbor;q=0.9, */*;q=0.1": codec.CBOR{},
+		"application/json;q=0.5, application/msgpack":  codec.MessagePack{},
+		"application/vnd.simpleplan.v2+json":           codec.JSON{},
+		"application/json;q=0, application/xml":        codec.XML{},
+	} {
+		c, err := r.Negotiate(accept)
+		assert.NoError(t, err, accept)
+		assert.Equal(t, want, c, accept)
+	}
+
+	for _, accept := range []string{"text/html", "image/*", "application/json;q=0"} {
+		_, err := r.Negotiate(accept)
+		assert.ErrorIs(t, err, codec.ErrNotAcceptable, accept)
+	}
+
+	// Registration order sets the preference
+	xmlFirst := codec.NewRegistry(codec.XML{}, codec.JSON{})
+	c, err := xmlFirst.Negotiate("*/*")
+	assert.NoError(t, err)
+	assert.Equal(t, codec.XML{}, c)
+}
+
+func TestDecodeStrict(t *testing.T) {
+	type batch struct {
+		Plans []model.Plan `json:"plans"`
+	}
+
+	for body, want := range map[string]string{
+		``:                                   "body must not be empty",
+		`{"plans": [`:                        "malformed JSON, unexpected end of body",
+		`{"plans" [}`:                        "malformed JSON at offset 10",
+		`{"plans": "all"}`:                   "plans: must be an array, got string",
+		`{"plans": {}}`:                      "plans: must be an array, got object",
+		`{"plans": [{"name": "a", "x": 1}]}`: "x: unknown field",
+		`{"plans": []} {"plans": []}`:        "body must hold a single JSON value",
+		`{"plans": []}]`:                     "body must hold a single JSON value",
+	} {
+		err := codec.DecodeStrict(strings.NewReader(body), &batch{})
+		var fieldErr *codec.FieldError
+		assert.ErrorAs(t, err, &fieldErr, body)
+		assert.EqualError(t, err, want, body)
+	}
+
+	var b batch
+	assert.NoError(t, codec.JSON{Strict: true}.Decode(strings.NewReader(`{"plans": [{"name": "a"}]}`+"\n"), &b))
+	assert.Equal(t, "a", b.Plans[0].Name)
+
+	// Lenient JSON keeps ignoring unknown fields
+	assert.NoError(t, codec.JSON{}.Decode(strings.NewReader(`{"x": 1}`), &b))
+}
@@ -0,0 +1,127 @@
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// JSON is the encoding/json codec. A Strict one decodes with DecodeStrict.
+type JSON struct {
+	Strict bool
+}
+
+func (JSON) MediaTypes() []string {
+	return []string{"application/json"}
+}
+
+func (JSON) Encode(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func (c JSON) Decode(r io.Reader, v interface{}) error {
+	if c.Strict {
+		return DecodeStrict(r, v)
+	}
+
+	return json.NewDecoder(r).Decode(v)
+}
+
+// FieldError is an invalid body, located at a field path such as "plans.0.name"
+// when known.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	if e.Field == "" {
+		return e.Message
+	}
+
+	return e.Field + ": " + e.Message
+}
+
+// DecodeStrict decodes a body holding a single JSON value into v, rejecting
+// unknown fields. Syntax and type errors are returned as a *FieldError, read
+// errors as they are.
+func DecodeStrict(r io.Reader, v interface{}) error {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(v); err != nil {
+		return jsonError(err)
+	}
+
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		var syntaxErr *json.SyntaxError
+		if err != nil && !errors.As(err, &syntaxErr) {
+			return err
+		}
+		return &FieldError{Message: "body must hold a single JSON value"}
+	}
+
+	return nil
+}
+
+// jsonError describes a decoding error of encoding/json.
+func jsonError(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.Is(err, io.EOF):
+		return &FieldError{Message: "body must not be empty"}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &FieldError{Message: "malformed JSON, unexpected end of body"}
+	case errors.As(err, &syntaxErr):
+		return &FieldError{Message: fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset)}
+	case errors.As(err, &typeErr):
+		return &FieldError{
+			Field:   typeErr.Field,
+			Message: fmt.Sprintf("must be %s, got %s", jsonKind(typeErr.Type), typeErr.Value),
+		}
+	}
+
+	// Unknown fields have no error type
+	if name, ok := cutPrefix(err.Error(), "json: unknown field "); ok {
+		return &FieldError{Field: strings.Trim(name, `"`), Message: "unknown field"}
+	}
+
+	return err
+}
+
+// jsonKind names the JSON value decoded into t.
+func jsonKind(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	default:
+		return t.String()
+	}
+}
+
+func cutPrefix(s, prefix string) (string, bool) {
+	if !strings.HasPrefix(s, prefix) {
+		return s, false
+	}
+
+	return s[len(prefix):], true
+}
@@ -0,0 +1,92 @@
+package codec
+
+import (
+	"encoding/xml"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// XML is the encoding/xml codec, values are written with the XML header.
+//
+// Slices have no root element in XML, so they're wrapped in one named after
+// the element type: a []*model.Plan is written as <plans><plan>…</plan></plans>,
+// and decoded back the same way.
+type XML struct{}
+
+func (XML) MediaTypes() []string {
+	return []string{"application/xml", "text/xml"}
+}
+
+func (XML) Encode(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() == reflect.Uint8 {
+		return enc.Encode(v)
+	}
+
+	name := elementName(rv.Type().Elem())
+	root := xml.StartElement{Name: xml.Name{Local: name + "s"}}
+	if err := enc.EncodeToken(root); err != nil {
+		return err
+	}
+	for i := 0; i < rv.Len(); i++ {
+		if err := enc.EncodeElement(rv.Index(i).Interface(), xml.StartElement{Name: xml.Name{Local: name}}); err != nil {
+			return err
+		}
+	}
+	if err := enc.EncodeToken(root.End()); err != nil {
+		return err
+	}
+
+	return enc.Flush()
+}
+
+func (XML) Decode(r io.Reader, v interface{}) error {
+	dec := xml.NewDecoder(r)
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice || rv.Elem().Type().Elem().Kind() == reflect.Uint8 {
+		return dec.Decode(v)
+	}
+
+	// Skip to the root element, then decode its children as the slice elements
+	list, typ := rv.Elem(), rv.Elem().Type().Elem()
+	for depth := 0; ; {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				depth++
+				continue
+			}
+			item := reflect.New(typ)
+			if err := dec.DecodeElement(item.Interface(), &t); err != nil {
+				return err
+			}
+			list.Set(reflect.Append(list, item.Elem()))
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// elementName returns the lowercase name of the type of the slice elements,
+// "item" for unnamed types.
+func elementName(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Name() == "" {
+		return "item"
+	}
+
+	return strings.ToLower(t.Name())
+}
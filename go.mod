@@ -2,10 +2,18 @@ module github.com/h4ckm03d/simpleplan
 
 go 1.18
 
-require github.com/stretchr/testify v1.7.2
+require (
+	github.com/fxamacker/cbor/v2 v2.7.0
+	github.com/stretchr/testify v1.7.2
+	github.com/vmihailenco/msgpack/v5 v5.3.5
+	golang.org/x/net v0.35.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+	golang.org/x/text v0.22.0 // indirect
 )
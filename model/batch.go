@@ -0,0 +1,26 @@
+package model
+
+// BatchOp is the kind of change applied by a BatchOperation.
+type BatchOp string
+
+const (
+	BatchCreate BatchOp = "create"
+	BatchUpdate BatchOp = "update"
+	BatchDelete BatchOp = "delete"
+)
+
+// BatchOperation is a single item of a batch request. Create and update use Plan,
+// delete uses ID. An update takes its target from ID when set, Plan.ID otherwise.
+type BatchOperation struct {
+	Op   BatchOp `json:"op" xml:"op"`
+	ID   int     `json:"id,omitempty" xml:"id,omitempty"`
+	Plan *Plan   `json:"plan,omitempty" xml:"plan,omitempty"`
+}
+
+// BatchResult is the outcome of the BatchOperation at Index.
+type BatchResult struct {
+	Index int
+	Op    BatchOp
+	Plan  *Plan
+	Err   error
+}
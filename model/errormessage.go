@@ -3,5 +3,13 @@ package model
 import "errors"
 
 var (
-	ErrNotFound = errors.New("not found")
+	ErrNotFound          = errors.New("not found")
+	ErrMethodNotAllowed  = errors.New("method not allowed")
+	ErrAlreadyExists     = errors.New("already exists")
+	ErrInvalidOperation  = errors.New("invalid operation")
+	ErrBatchAborted      = errors.New("batch aborted")
+	ErrInvalidStatus     = errors.New("invalid status")
+	ErrIllegalTransition = errors.New("illegal status transition")
+	ErrTimeout           = errors.New("request timed out")
+	ErrKeyReused         = errors.New("idempotency key reused with a different request")
 )
@@ -0,0 +1,10 @@
+package model
+
+import "net/http"
+
+// IdempotentResponse is the stored response of a request made with an idempotency key.
+type IdempotentResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
@@ -3,9 +3,13 @@ package model
 import "time"
 
 type Plan struct {
-	ID          int       `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          int       `json:"id" yaml:"id" xml:"id"`
+	Name        string    `json:"name" yaml:"name" xml:"name"`
+	Description string    `json:"description" yaml:"description" xml:"description"`
+	Status      Status    `json:"status" yaml:"status" xml:"status"`
+	CreatedAt   time.Time `json:"created_at" yaml:"created_at" xml:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" yaml:"updated_at" xml:"updated_at"`
+
+	// Transitions lists the status changes, oldest first
+	Transitions []StatusTransition `json:"transitions,omitempty" yaml:"transitions,omitempty" xml:"transitions>transition,omitempty"`
 }
@@ -0,0 +1,113 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Status is the progress of a plan, changed with transitions allowed by a StateMachine.
+type Status string
+
+const (
+	StatusDraft      Status = "draft"
+	StatusActive     Status = "active"
+	StatusInProgress Status = "in_progress"
+	StatusBlocked    Status = "blocked"
+	StatusDone       Status = "done"
+	StatusCancelled  Status = "cancelled"
+)
+
+// Statuses lists every status, in the order of a plan lifecycle.
+var Statuses = []Status{StatusDraft, StatusActive, StatusInProgress, StatusBlocked, StatusDone, StatusCancelled}
+
+// ParseStatus returns the status named s.
+func ParseStatus(s string) (Status, error) {
+	for _, st := range Statuses {
+		if string(st) == s {
+			return st, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w %q", ErrInvalidStatus, s)
+}
+
+// StatusTransition records a status change of a plan.
+type StatusTransition struct {
+	From Status    `json:"from" yaml:"from" xml:"from"`
+	To   Status    `json:"to" yaml:"to" xml:"to"`
+	At   time.Time `json:"at" yaml:"at" xml:"at"`
+}
+
+// StateMachine lists the statuses a plan may move to from each status.
+type StateMachine map[Status][]Status
+
+// DefaultStateMachine lets plans go from draft to done, blocked on the way, or be
+// cancelled before they're done. Done and cancelled plans are final.
+func DefaultStateMachine() StateMachine {
+	return StateMachine{
+		StatusDraft:      {StatusActive, StatusCancelled},
+		StatusActive:     {StatusInProgress, StatusBlocked, StatusDone, StatusCancelled},
+		StatusInProgress: {StatusBlocked, StatusDone, StatusCancelled},
+		StatusBlocked:    {StatusActive, StatusInProgress, StatusCancelled},
+	}
+}
+
+// ParseStateMachine reads transitions written as "from:to,to;from:to", e.g.
+// "draft:active;active:done,cancelled".
+func ParseStateMachine(s string) (StateMachine, error) {
+	sm := make(StateMachine)
+	for _, rule := range strings.Split(s, ";") {
+		if rule = strings.TrimSpace(rule); rule == "" {
+			continue
+		}
+
+		from, tos, ok := strings.Cut(rule, ":")
+		if !ok {
+			return nil, fmt.Errorf("transition %q: want from:to,to", rule)
+		}
+		fromStatus, err := ParseStatus(strings.TrimSpace(from))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, to := range strings.Split(tos, ",") {
+			toStatus, err := ParseStatus(strings.TrimSpace(to))
+			if err != nil {
+				return nil, err
+			}
+			sm[fromStatus] = append(sm[fromStatus], toStatus)
+		}
+	}
+
+	return sm, nil
+}
+
+// Allows reports if a plan may move from one status to the other.
+func (sm StateMachine) Allows(from, to Status) bool {
+	for _, s := range sm[from] {
+		if s == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// String writes sm in the format read by ParseStateMachine.
+func (sm StateMachine) String() string {
+	rules := make([]string, 0, len(sm))
+	for _, from := range Statuses {
+		if len(sm[from]) == 0 {
+			continue
+		}
+
+		tos := make([]string, len(sm[from]))
+		for i, to := range sm[from] {
+			tos[i] = string(to)
+		}
+		rules = append(rules, string(from)+":"+strings.Join(tos, ","))
+	}
+
+	return strings.Join(rules, ";")
+}
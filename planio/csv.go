@@ -0,0 +1,164 @@
+package planio
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/h4ckm03d/simpleplan/model"
+)
+
+// csvHeader is the column order written by the CSV encoder. The decoder accepts
+// any order as long as the header names the columns, without status for files
+// written before plans had one. The status history isn't kept.
+var csvHeader = []string{"id", "name", "description", "status", "created_at", "updated_at"}
+
+type csvEncoder struct {
+	w      *csv.Writer
+	header bool
+}
+
+func newCSVEncoder(w io.Writer) *csvEncoder {
+	return &csvEncoder{w: csv.NewWriter(w)}
+}
+
+func (e *csvEncoder) Encode(plan *model.Plan) error {
+	if !e.header {
+		e.header = true
+		if err := e.w.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+
+	return e.w.Write([]string{
+		strconv.Itoa(plan.ID),
+		plan.Name,
+		plan.Description,
+		string(plan.Status),
+		plan.CreatedAt.Format(time.RFC3339Nano),
+		plan.UpdatedAt.Format(time.RFC3339Nano),
+	})
+}
+
+func (e *csvEncoder) Close() error {
+	if !e.header {
+		// Always write the header so an empty export is still a valid CSV file
+		if err := e.w.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type csvDecoder struct {
+	r       *csv.Reader
+	columns map[string]int
+	line    int
+}
+
+func newCSVDecoder(r io.Reader) *csvDecoder {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	return &csvDecoder{r: cr}
+}
+
+func (d *csvDecoder) Decode() (*model.Plan, error) {
+	if d.columns == nil {
+		if err := d.readHeader(); err != nil {
+			return nil, err
+		}
+	}
+
+	record, err := d.r.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, io.EOF
+	}
+
+	var perr *csv.ParseError
+	if errors.As(err, &perr) {
+		d.line = perr.StartLine
+		return nil, &LineError{Line: perr.StartLine, Err: perr.Err}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d.line, _ = d.r.FieldPos(0)
+	plan, err := d.plan(record)
+	if err != nil {
+		return nil, &LineError{Line: d.line, Err: err}
+	}
+
+	return plan, nil
+}
+
+func (d *csvDecoder) Line() int {
+	return d.line
+}
+
+func (d *csvDecoder) readHeader() error {
+	header, err := d.r.Read()
+	if errors.Is(err, io.EOF) {
+		return io.EOF
+	}
+	if err != nil {
+		return fmt.Errorf("csv header: %w", err)
+	}
+
+	d.columns = make(map[string]int, len(header))
+	for i, name := range header {
+		d.columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	if _, ok := d.columns["name"]; !ok {
+		return errors.New("csv header: missing name column")
+	}
+
+	return nil
+}
+
+func (d *csvDecoder) plan(record []string) (*model.Plan, error) {
+	field := func(name string) string {
+		if i, ok := d.columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	plan := &model.Plan{
+		Name:        field("name"),
+		Description: field("description"),
+	}
+
+	var err error
+	if v := field("id"); v != "" {
+		if plan.ID, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("id: invalid number %q", v)
+		}
+	}
+	plan.Status = model.StatusDraft
+	if v := field("status"); v != "" {
+		if plan.Status, err = model.ParseStatus(v); err != nil {
+			return nil, fmt.Errorf("status: %w", err)
+		}
+	}
+	if v := field("created_at"); v != "" {
+		if plan.CreatedAt, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			return nil, fmt.Errorf("created_at: %w", err)
+		}
+	}
+	if v := field("updated_at"); v != "" {
+		if plan.UpdatedAt, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			return nil, fmt.Errorf("updated_at: %w", err)
+		}
+	}
+
+	return plan, nil
+}
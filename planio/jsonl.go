@@ -0,0 +1,68 @@
+package planio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/h4ckm03d/simpleplan/model"
+)
+
+type jsonlEncoder struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func newJSONLEncoder(w io.Writer) *jsonlEncoder {
+	bw := bufio.NewWriter(w)
+	return &jsonlEncoder{w: bw, enc: json.NewEncoder(bw)}
+}
+
+func (e *jsonlEncoder) Encode(plan *model.Plan) error {
+	return e.enc.Encode(plan)
+}
+
+func (e *jsonlEncoder) Close() error {
+	return e.w.Flush()
+}
+
+type jsonlDecoder struct {
+	r    *bufio.Reader
+	line int
+}
+
+func newJSONLDecoder(r io.Reader) *jsonlDecoder {
+	return &jsonlDecoder{r: bufio.NewReader(r)}
+}
+
+func (d *jsonlDecoder) Decode() (*model.Plan, error) {
+	for {
+		b, err := d.r.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		if len(b) == 0 && errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+
+		d.line++
+		b = bytes.TrimSpace(b)
+		if len(b) == 0 {
+			// Skip blank lines
+			continue
+		}
+
+		var plan model.Plan
+		if err := json.Unmarshal(b, &plan); err != nil {
+			return nil, &LineError{Line: d.line, Err: err}
+		}
+
+		return &plan, nil
+	}
+}
+
+func (d *jsonlDecoder) Line() int {
+	return d.line
+}
@@ -0,0 +1,128 @@
+// Package planio streams plans in the supported interchange formats, one record at a
+// time, so that imports and exports never hold the whole data set in memory.
+package planio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/h4ckm03d/simpleplan/model"
+)
+
+// Format is the name of an interchange format.
+type Format string
+
+const (
+	JSONL Format = "jsonl"
+	CSV   Format = "csv"
+	YAML  Format = "yaml"
+)
+
+// ErrUnknownFormat is returned for a format without encoder and decoder.
+var ErrUnknownFormat = errors.New("unknown format")
+
+var contentTypes = map[Format]string{
+	JSONL: "application/x-ndjson",
+	CSV:   "text/csv",
+	YAML:  "application/yaml",
+}
+
+// Encoder writes plans one by one. Close flushes any buffered data and must be
+// called once all plans are written.
+type Encoder interface {
+	Encode(plan *model.Plan) error
+	Close() error
+}
+
+// Decoder reads plans one by one and returns io.EOF at the end of the input.
+// A *LineError reports a record that couldn't be decoded, Decode can be called
+// again to continue with the next record. Any other error is fatal.
+type Decoder interface {
+	Decode() (*model.Plan, error)
+
+	// Line returns the line where the last decoded record starts.
+	Line() int
+}
+
+// LineError is a decoding error for the record starting at Line.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// ParseFormat validates a format name, accepting "ndjson" and "yml" as aliases.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case JSONL, CSV, YAML:
+		return f, nil
+	case "ndjson":
+		return JSONL, nil
+	case "yml":
+		return YAML, nil
+	}
+
+	return "", fmt.Errorf("%w %q (jsonl|csv|yaml)", ErrUnknownFormat, s)
+}
+
+// FormatOf guesses the format from a file name or content type, it returns an
+// empty Format when nothing matches.
+func FormatOf(s string) Format {
+	if mt, _, err := mime.ParseMediaType(s); err == nil {
+		for f, ct := range contentTypes {
+			if ct == mt {
+				return f
+			}
+		}
+	}
+
+	if f, err := ParseFormat(strings.TrimPrefix(path.Ext(s), ".")); err == nil {
+		return f
+	}
+
+	return ""
+}
+
+// ContentType returns the media type of the format.
+func ContentType(f Format) string {
+	return contentTypes[f]
+}
+
+// NewEncoder returns an Encoder writing f to w.
+func NewEncoder(f Format, w io.Writer) (Encoder, error) {
+	switch f {
+	case JSONL:
+		return newJSONLEncoder(w), nil
+	case CSV:
+		return newCSVEncoder(w), nil
+	case YAML:
+		return newYAMLEncoder(w), nil
+	}
+
+	return nil, fmt.Errorf("%w %q", ErrUnknownFormat, f)
+}
+
+// NewDecoder returns a Decoder reading f from r.
+func NewDecoder(f Format, r io.Reader) (Decoder, error) {
+	switch f {
+	case JSONL:
+		return newJSONLDecoder(r), nil
+	case CSV:
+		return newCSVDecoder(r), nil
+	case YAML:
+		return newYAMLDecoder(r), nil
+	}
+
+	return nil, fmt.Errorf("%w %q", ErrUnknownFormat, f)
+}
@@ -0,0 +1,131 @@
+package planio_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/h4ckm03d/simpleplan/model"
+	"github.com/h4ckm03d/simpleplan/planio"
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeAll(t *testing.T, dec planio.Decoder) ([]*model.Plan, []int) {
+	t.Helper()
+	var plans []*model.Plan
+	var failed []int
+	for {
+		plan, err := dec.Decode()
+		if errors.Is(err, io.EOF) {
+			return plans, failed
+		}
+
+		var lerr *planio.LineError
+		if errors.As(err, &lerr) {
+			failed = append(failed, lerr.Line)
+			continue
+		}
+		if !assert.NoError(t, err) {
+			return plans, failed
+		}
+		plans = append(plans, plan)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	now := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	plans := []*model.Plan{
+		{ID: 3, Name: "First", Description: "with, comma\nand newline", Status: model.StatusDone, CreatedAt: now, UpdatedAt: now},
+		{ID: 7, Name: "Second", Status: model.StatusDraft, CreatedAt: now, UpdatedAt: now.Add(time.Hour)},
+	}
+
+	for _, format := range []planio.Format{planio.JSONL, planio.CSV, planio.YAML} {
+		t.Run(string(format), func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			enc, err := planio.NewEncoder(format, buf)
+			assert.NoError(t, err)
+			for _, p := range plans {
+				assert.NoError(t, enc.Encode(p))
+			}
+			assert.NoError(t, enc.Close())
+
+			dec, err := planio.NewDecoder(format, buf)
+			assert.NoError(t, err)
+			got, failed := decodeAll(t, dec)
+			assert.Empty(t, failed)
+			assert.Equal(t, plans, got)
+		})
+	}
+}
+
+func TestCSVStatus(t *testing.T) {
+	// Files written before plans had a status import as drafts
+	dec, err := planio.NewDecoder(planio.CSV, strings.NewReader("id,name\n1,Old\n"))
+	assert.NoError(t, err)
+	plans, failed := decodeAll(t, dec)
+	assert.Empty(t, failed)
+	assert.Equal(t, []*model.Plan{{ID: 1, Name: "Old", Status: model.StatusDraft}}, plans)
+
+	dec, err = planio.NewDecoder(planio.CSV, strings.NewReader("name,status\na,active\nb,\nc,started\n"))
+	assert.NoError(t, err)
+	plans, failed = decodeAll(t, dec)
+	assert.Equal(t, []int{4}, failed)
+	if assert.Len(t, plans, 2) {
+		assert.Equal(t, model.StatusActive, plans[0].Status)
+		assert.Equal(t, model.StatusDraft, plans[1].Status)
+	}
+}
+
+func TestLineErrors(t *testing.T) {
+	tests := map[planio.Format]struct {
+		input  string
+		names  []string
+		failed []int
+	}{
+		planio.JSONL: {
+			input:  "{\"name\":\"a\"}\n\n{\"name\":\n{\"id\":\"x\"}\n{\"name\":\"b\"}",
+			names:  []string{"a", "b"},
+			failed: []int{3, 4},
+		},
+		planio.CSV: {
+			input:  "name,id\na,1\nb,x\n\"c,2\nd,4\n",
+			names:  []string{"a"},
+			failed: []int{3, 4},
+		},
+		planio.YAML: {
+			input:  "name: a\n---\nid: x\n---\nname: b\n",
+			names:  []string{"a", "b"},
+			failed: []int{3},
+		},
+	}
+
+	for format, tt := range tests {
+		t.Run(string(format), func(t *testing.T) {
+			dec, err := planio.NewDecoder(format, strings.NewReader(tt.input))
+			assert.NoError(t, err)
+			plans, failed := decodeAll(t, dec)
+			names := []string{}
+			for _, p := range plans {
+				names = append(names, p.Name)
+			}
+			assert.Equal(t, tt.names, names)
+			assert.Equal(t, tt.failed, failed)
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	f, err := planio.ParseFormat("NDJSON")
+	assert.NoError(t, err)
+	assert.Equal(t, planio.JSONL, f)
+
+	_, err = planio.ParseFormat("xml")
+	assert.ErrorIs(t, err, planio.ErrUnknownFormat)
+
+	assert.Equal(t, planio.CSV, planio.FormatOf("text/csv; charset=utf-8"))
+	assert.Equal(t, planio.YAML, planio.FormatOf("backup/plans.yml"))
+	assert.Equal(t, planio.Format(""), planio.FormatOf("plans.txt"))
+}
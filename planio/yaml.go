@@ -0,0 +1,68 @@
+package planio
+
+import (
+	"errors"
+	"io"
+
+	"github.com/h4ckm03d/simpleplan/model"
+	"gopkg.in/yaml.v3"
+)
+
+// The YAML format is a stream of documents, one plan per document.
+
+type yamlEncoder struct {
+	enc *yaml.Encoder
+}
+
+func newYAMLEncoder(w io.Writer) *yamlEncoder {
+	return &yamlEncoder{enc: yaml.NewEncoder(w)}
+}
+
+func (e *yamlEncoder) Encode(plan *model.Plan) error {
+	return e.enc.Encode(plan)
+}
+
+func (e *yamlEncoder) Close() error {
+	return e.enc.Close()
+}
+
+type yamlDecoder struct {
+	dec  *yaml.Decoder
+	line int
+}
+
+func newYAMLDecoder(r io.Reader) *yamlDecoder {
+	return &yamlDecoder{dec: yaml.NewDecoder(r)}
+}
+
+func (d *yamlDecoder) Decode() (*model.Plan, error) {
+	for {
+		// Decode into a node first so a bad document is reported with its line
+		// while the decoder stays usable for the next one. Syntax errors can't be
+		// recovered from and end the stream.
+		var doc yaml.Node
+		if err := d.dec.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, io.EOF
+			}
+			return nil, err
+		}
+
+		if len(doc.Content) == 0 {
+			// Skip empty documents
+			continue
+		}
+
+		d.line = doc.Content[0].Line
+		var plan model.Plan
+		if err := doc.Content[0].Decode(&plan); err != nil {
+			return nil, &LineError{Line: d.line, Err: err}
+		}
+
+		return &plan, nil
+	}
+}
+
+func (d *yamlDecoder) Line() int {
+	return d.line
+}
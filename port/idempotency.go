@@ -0,0 +1,23 @@
+package port
+
+import (
+	"context"
+
+	"github.com/h4ckm03d/simpleplan/model"
+)
+
+// IdempotencyStore keeps the responses of requests sent with an idempotency key.
+type IdempotencyStore interface {
+	// Begin claims key for a request identified by hash. It returns a nil response
+	// when the caller should process the request and then call Complete or Abort,
+	// or the stored response of an earlier request to replay. A key held by a
+	// request in flight blocks until that request ends or ctx is done. A key
+	// stored for a different hash returns model.ErrKeyReused.
+	Begin(ctx context.Context, key, hash string) (*model.IdempotentResponse, error)
+
+	// Complete stores the response for a claimed key.
+	Complete(key string, res *model.IdempotentResponse)
+
+	// Abort releases a claimed key without storing anything, so it can be retried.
+	Abort(key string)
+}
@@ -3,9 +3,28 @@ package port
 import "github.com/h4ckm03d/simpleplan/model"
 
 type PlanRepo interface {
+	// Create stores plan with a new ID, always in draft: another status is refused.
 	Create(plan *model.Plan) (*model.Plan, error)
 	Get(id int) (*model.Plan, error)
+
+	// Update replaces the name and description of a plan. The status changes by
+	// Transition only, a status other than the current one is refused.
 	Update(plan *model.Plan) (*model.Plan, error)
 	Delete(id int) error
 	GetAll(limit, page int) ([]*model.Plan, error)
+
+	// GetAllByStatus lists the plans in status, paginated like GetAll.
+	GetAllByStatus(status model.Status, limit, page int) ([]*model.Plan, error)
+
+	// Transition moves a plan to status when sm allows it from the current one,
+	// recording the change, and returns model.ErrIllegalTransition otherwise.
+	Transition(id int, status model.Status, sm model.StateMachine) (*model.Plan, error)
+
+	// Restore stores plan keeping its ID and timestamps, e.g. when importing a backup.
+	Restore(plan *model.Plan) (*model.Plan, error)
+
+	// Batch applies ops in order while holding the repository lock once.
+	// With atomic set, the first failure rolls back every change, marks the
+	// remaining operations with model.ErrBatchAborted and returns that error.
+	Batch(ops []model.BatchOperation, atomic bool) ([]model.BatchResult, error)
 }
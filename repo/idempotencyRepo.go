@@ -0,0 +1,139 @@
+package repo
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/h4ckm03d/simpleplan/model"
+	"github.com/h4ckm03d/simpleplan/port"
+)
+
+// idempotencyEntry is a claimed key. done is closed once the request holding the
+// key ends, res stays nil for an aborted request.
+type idempotencyEntry struct {
+	hash      string
+	res       *model.IdempotentResponse
+	done      chan struct{}
+	expiresAt time.Time
+}
+
+// IdempotencyRepo is an in memory port.IdempotencyStore. Stored responses expire
+// after a TTL measured with the TimeProvider.
+type IdempotencyRepo struct {
+	ttl       time.Duration
+	entries   map[string]*idempotencyEntry
+	lastSweep time.Time
+	m         sync.Mutex
+	port.TimeProvider
+}
+
+var _ port.IdempotencyStore = &IdempotencyRepo{}
+
+func NewIdempotencyRepo(tp port.TimeProvider, ttl time.Duration) *IdempotencyRepo {
+	return &IdempotencyRepo{
+		ttl:          ttl,
+		entries:      make(map[string]*idempotencyEntry),
+		TimeProvider: tp,
+	}
+}
+
+func (r *IdempotencyRepo) Now() time.Time {
+	if r.TimeProvider != nil {
+		return r.TimeProvider.Now()
+	}
+
+	return time.Now()
+}
+
+func (r *IdempotencyRepo) Begin(ctx context.Context, key, hash string) (*model.IdempotentResponse, error) {
+	for {
+		r.m.Lock()
+		now := r.Now()
+		r.sweep(now)
+
+		e, found := r.entries[key]
+		if found && r.expired(e, now) {
+			delete(r.entries, key)
+			found = false
+		}
+		if !found {
+			r.entries[key] = &idempotencyEntry{hash: hash, done: make(chan struct{})}
+			r.m.Unlock()
+			return nil, nil
+		}
+
+		if e.hash != hash {
+			r.m.Unlock()
+			return nil, model.ErrKeyReused
+		}
+
+		select {
+		case <-e.done:
+			// Completed, aborted entries are removed right away
+			r.m.Unlock()
+			return e.res, nil
+		default:
+		}
+		r.m.Unlock()
+
+		// Another request holds the key, wait for it and look again
+		select {
+		case <-e.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (r *IdempotencyRepo) Complete(key string, res *model.IdempotentResponse) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	e, found := r.entries[key]
+	if !found || isClosed(e.done) {
+		return
+	}
+
+	e.res = res
+	e.expiresAt = r.Now().Add(r.ttl)
+	close(e.done)
+}
+
+func (r *IdempotencyRepo) Abort(key string) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	e, found := r.entries[key]
+	if !found || isClosed(e.done) {
+		return
+	}
+
+	delete(r.entries, key)
+	close(e.done)
+}
+
+// sweep drops expired responses, at most once per TTL. The caller must hold the lock.
+func (r *IdempotencyRepo) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < r.ttl {
+		return
+	}
+
+	r.lastSweep = now
+	for key, e := range r.entries {
+		if r.expired(e, now) {
+			delete(r.entries, key)
+		}
+	}
+}
+
+func (r *IdempotencyRepo) expired(e *idempotencyEntry, now time.Time) bool {
+	return isClosed(e.done) && !now.Before(e.expiresAt)
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,100 @@
+package repo_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/h4ckm03d/simpleplan/model"
+	"github.com/h4ckm03d/simpleplan/repo"
+	"github.com/stretchr/testify/assert"
+)
+
+type clock struct {
+	m   sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.now
+}
+
+func (c *clock) Add(d time.Duration) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestIdempotencyRepo(t *testing.T) {
+	ctx := context.Background()
+	c := &clock{now: (&testTime{}).Now()}
+	r := repo.NewIdempotencyRepo(c, time.Hour)
+
+	res, err := r.Begin(ctx, "key", "hash")
+	assert.NoError(t, err)
+	assert.Nil(t, res)
+
+	stored := &model.IdempotentResponse{Status: 201, Body: []byte("created")}
+	r.Complete("key", stored)
+
+	// Replay
+	res, err = r.Begin(ctx, "key", "hash")
+	assert.NoError(t, err)
+	assert.Equal(t, stored, res)
+
+	// Same key, other request
+	_, err = r.Begin(ctx, "key", "other")
+	assert.ErrorIs(t, err, model.ErrKeyReused)
+
+	// Aborted keys can be claimed again
+	res, err = r.Begin(ctx, "retry", "hash")
+	assert.NoError(t, err)
+	assert.Nil(t, res)
+	r.Abort("retry")
+	res, err = r.Begin(ctx, "retry", "hash")
+	assert.NoError(t, err)
+	assert.Nil(t, res)
+
+	// Expired after the TTL
+	c.Add(time.Hour)
+	res, err = r.Begin(ctx, "key", "other")
+	assert.NoError(t, err)
+	assert.Nil(t, res)
+}
+
+func TestIdempotencyRepo_Concurrent(t *testing.T) {
+	r := repo.NewIdempotencyRepo(nil, time.Hour)
+
+	res, err := r.Begin(context.Background(), "key", "hash")
+	assert.NoError(t, err)
+	assert.Nil(t, res)
+
+	// Requests with a key in flight wait for the first one to finish
+	var wg sync.WaitGroup
+	results := make([]*model.IdempotentResponse, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = r.Begin(context.Background(), "key", "hash")
+		}(i)
+	}
+
+	stored := &model.IdempotentResponse{Status: 201}
+	r.Complete("key", stored)
+	wg.Wait()
+	for _, res := range results {
+		assert.Equal(t, stored, res)
+	}
+
+	// Waiting stops with the context
+	_, err = r.Begin(context.Background(), "slow", "hash")
+	assert.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = r.Begin(ctx, "slow", "hash")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -1,6 +1,7 @@
 package repo
 
 import (
+	"fmt"
 	"sort"
 	"sync"
 	"time"
@@ -9,11 +10,14 @@ import (
 	"github.com/h4ckm03d/simpleplan/port"
 )
 
+// PlanRepo is an in memory port.PlanRepo safe for concurrent use. Plans are
+// copied in and out, callers never share the stored ones, which are replaced
+// rather than modified once stored.
 type PlanRepo struct {
-	Id     int
-	Data   map[int]*model.Plan
-	ListId []int
-	m      sync.Mutex
+	id     int
+	data   map[int]*model.Plan
+	listID []int
+	m      sync.RWMutex
 	port.TimeProvider
 }
 
@@ -21,46 +25,90 @@ var _ port.PlanRepo = &PlanRepo{}
 
 func NewPlanRepo(tp port.TimeProvider) *PlanRepo {
 	return &PlanRepo{
-		Id:           0,
-		Data:         make(map[int]*model.Plan),
-		ListId:       []int{},
+		id:           0,
+		data:         make(map[int]*model.Plan),
+		listID:       []int{},
 		TimeProvider: tp,
 	}
 }
+
+// clonePlan returns a copy of plan not sharing any memory with it.
+func clonePlan(plan *model.Plan) *model.Plan {
+	c := *plan
+	c.Transitions = append([]model.StatusTransition(nil), plan.Transitions...)
+	return &c
+}
+
 func (r *PlanRepo) Create(plan *model.Plan) (*model.Plan, error) {
 	r.m.Lock()
 	defer r.m.Unlock()
-	plan.CreatedAt = r.Now()
-	plan.UpdatedAt = r.Now()
-	r.Id++
-	plan.ID = r.Id
-	r.Data[plan.ID] = plan
-	r.ListId = append(r.ListId, plan.ID)
-	return plan, nil
+	return r.create(plan)
+}
+
+// create stores a copy of plan with a new ID, in draft: any other status is
+// refused, statuses change by transitions only. The caller must hold the lock.
+func (r *PlanRepo) create(plan *model.Plan) (*model.Plan, error) {
+	if plan.Status != "" && plan.Status != model.StatusDraft {
+		return nil, fmt.Errorf("%w: new plans start in %s", model.ErrInvalidOperation, model.StatusDraft)
+	}
+
+	stored := clonePlan(plan)
+	stored.Status = model.StatusDraft
+	stored.Transitions = nil
+	stored.CreatedAt = r.Now()
+	stored.UpdatedAt = stored.CreatedAt
+	r.id++
+	stored.ID = r.id
+	r.data[stored.ID] = stored
+	r.listID = append(r.listID, stored.ID)
+	return clonePlan(stored), nil
+}
+
+// initialStatus returns the status of a restored plan, draft if empty.
+func initialStatus(s model.Status) (model.Status, error) {
+	if s == "" {
+		return model.StatusDraft, nil
+	}
+
+	return model.ParseStatus(string(s))
 }
 
 func (r *PlanRepo) Get(id int) (*model.Plan, error) {
-	plan, ok := r.Data[int(id)]
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	plan, ok := r.data[id]
 	if !ok {
 		return nil, model.ErrNotFound
 	}
 
-	return plan, nil
+	return clonePlan(plan), nil
 }
 
 func (r *PlanRepo) Update(plan *model.Plan) (*model.Plan, error) {
 	r.m.Lock()
 	defer r.m.Unlock()
-	_, found := r.Data[plan.ID]
-	if plan.ID == 0 || plan.ID > r.Id || !found {
+	return r.update(plan)
+}
+
+// update replaces the name and description of a stored plan, returning the
+// updated plan. A status is refused unless it's the current one, statuses change
+// by transitions only. The caller must hold the lock.
+func (r *PlanRepo) update(plan *model.Plan) (*model.Plan, error) {
+	current, found := r.data[plan.ID]
+	if !found {
 		return nil, model.ErrNotFound
 	}
-	newPlan := r.Data[plan.ID]
-	newPlan.UpdatedAt = r.Now()
-	newPlan.Name = plan.Name
-	newPlan.Description = plan.Description
-	r.Data[plan.ID] = newPlan
-	return plan, nil
+	if plan.Status != "" && plan.Status != current.Status {
+		return nil, fmt.Errorf("%w: the status changes by transition only", model.ErrInvalidOperation)
+	}
+
+	updated := clonePlan(current)
+	updated.UpdatedAt = r.Now()
+	updated.Name = plan.Name
+	updated.Description = plan.Description
+	r.data[plan.ID] = updated
+	return clonePlan(updated), nil
 }
 
 func (r *PlanRepo) Now() time.Time {
@@ -74,20 +122,30 @@ func (r *PlanRepo) Now() time.Time {
 func (r *PlanRepo) Delete(id int) error {
 	r.m.Lock()
 	defer r.m.Unlock()
-	if _, found := r.Data[id]; !found {
+	return r.delete(id)
+}
+
+func (r *PlanRepo) delete(id int) error {
+	if _, found := r.data[id]; !found {
 		return model.ErrNotFound
 	}
 
-	delete(r.Data, id)
-	// data always sorted because listId is incremental id
-	index := sort.SearchInts(r.ListId, id)
-	r.ListId = append(r.ListId[:index], r.ListId[index+1:]...)
+	delete(r.data, id)
+	// listID always sorted because ids are incremental
+	index := sort.SearchInts(r.listID, id)
+	r.listID = append(r.listID[:index], r.listID[index+1:]...)
 	return nil
 }
 
 func (r *PlanRepo) GetAll(limit, page int) ([]*model.Plan, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
 	plans := make([]*model.Plan, 0)
-	totalLen := len(r.ListId)
+	totalLen := len(r.listID)
+	if limit <= 0 || page < 0 {
+		return plans, nil
+	}
 
 	start := page * limit
 	end := start + limit
@@ -101,10 +159,179 @@ func (r *PlanRepo) GetAll(limit, page int) ([]*model.Plan, error) {
 	}
 
 	for ; start < end && start < totalLen; start++ {
-		if plan, ok := r.Data[r.ListId[start]]; ok {
-			plans = append(plans, plan)
+		if plan, ok := r.data[r.listID[start]]; ok {
+			plans = append(plans, clonePlan(plan))
 		}
 	}
 
 	return plans, nil
 }
+
+func (r *PlanRepo) GetAllByStatus(status model.Status, limit, page int) ([]*model.Plan, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	plans := make([]*model.Plan, 0)
+	if limit <= 0 || page < 0 {
+		return plans, nil
+	}
+
+	skip := page * limit
+	for _, id := range r.listID {
+		if len(plans) >= limit {
+			break
+		}
+
+		plan := r.data[id]
+		if plan.Status != status {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		plans = append(plans, clonePlan(plan))
+	}
+
+	return plans, nil
+}
+
+func (r *PlanRepo) Transition(id int, status model.Status, sm model.StateMachine) (*model.Plan, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	current, found := r.data[id]
+	if !found {
+		return nil, model.ErrNotFound
+	}
+	if !sm.Allows(current.Status, status) {
+		return nil, fmt.Errorf("%w from %s to %s", model.ErrIllegalTransition, current.Status, status)
+	}
+
+	updated := clonePlan(current)
+	updated.Status = status
+	updated.UpdatedAt = r.Now()
+	updated.Transitions = append(updated.Transitions, model.StatusTransition{
+		From: current.Status,
+		To:   status,
+		At:   updated.UpdatedAt,
+	})
+	r.data[id] = updated
+	return clonePlan(updated), nil
+}
+
+func (r *PlanRepo) Restore(plan *model.Plan) (*model.Plan, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if plan.ID <= 0 {
+		return nil, model.ErrInvalidOperation
+	}
+	if _, found := r.data[plan.ID]; found {
+		return nil, model.ErrAlreadyExists
+	}
+	status, err := initialStatus(plan.Status)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := clonePlan(plan)
+	stored.Status = status
+	if stored.CreatedAt.IsZero() {
+		stored.CreatedAt = r.Now()
+	}
+	if stored.UpdatedAt.IsZero() {
+		stored.UpdatedAt = stored.CreatedAt
+	}
+
+	r.data[stored.ID] = stored
+	// keep listID sorted, restored ids can be anywhere in the sequence
+	index := sort.SearchInts(r.listID, stored.ID)
+	r.listID = append(r.listID, 0)
+	copy(r.listID[index+1:], r.listID[index:])
+	r.listID[index] = stored.ID
+	if stored.ID > r.id {
+		r.id = stored.ID
+	}
+
+	return clonePlan(stored), nil
+}
+
+func (r *PlanRepo) Batch(ops []model.BatchOperation, atomic bool) ([]model.BatchResult, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	var snap *snapshot
+	if atomic {
+		snap = r.snapshot()
+	}
+
+	results := make([]model.BatchResult, len(ops))
+	for i, op := range ops {
+		results[i] = model.BatchResult{Index: i, Op: op.Op}
+		results[i].Plan, results[i].Err = r.apply(op)
+
+		if atomic && results[i].Err != nil {
+			r.restore(snap)
+			for j := range results {
+				if j != i {
+					results[j] = model.BatchResult{Index: j, Op: ops[j].Op, Err: model.ErrBatchAborted}
+				}
+			}
+			return results, model.ErrBatchAborted
+		}
+	}
+
+	return results, nil
+}
+
+// apply runs a single batch operation, the caller must hold the lock.
+func (r *PlanRepo) apply(op model.BatchOperation) (*model.Plan, error) {
+	switch op.Op {
+	case model.BatchCreate:
+		if op.Plan == nil {
+			return nil, model.ErrInvalidOperation
+		}
+		return r.create(op.Plan)
+	case model.BatchUpdate:
+		if op.Plan == nil {
+			return nil, model.ErrInvalidOperation
+		}
+		plan := op.Plan
+		if op.ID != 0 {
+			plan = clonePlan(op.Plan)
+			plan.ID = op.ID
+		}
+		return r.update(plan)
+	case model.BatchDelete:
+		return nil, r.delete(op.ID)
+	}
+
+	return nil, model.ErrInvalidOperation
+}
+
+// snapshot is a copy of the repository state used to roll back atomic batches.
+// Stored plans are never modified, so sharing them is enough.
+type snapshot struct {
+	id     int
+	data   map[int]*model.Plan
+	listID []int
+}
+
+func (r *PlanRepo) snapshot() *snapshot {
+	s := &snapshot{
+		id:     r.id,
+		data:   make(map[int]*model.Plan, len(r.data)),
+		listID: append([]int(nil), r.listID...),
+	}
+	for id, plan := range r.data {
+		s.data[id] = plan
+	}
+
+	return s
+}
+
+func (r *PlanRepo) restore(s *snapshot) {
+	r.id = s.id
+	r.listID = s.listID
+	r.data = s.data
+}
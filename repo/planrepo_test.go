@@ -1,6 +1,9 @@
 package repo_test
 
 import (
+	"fmt"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -167,4 +170,267 @@ func TestPlanRepo_GetAll(t *testing.T) {
 	plans, err = r.GetAll(10, 1)
 	assert.NoError(t, err)
 	assert.Equal(t, []*model.Plan{}, plans)
+
+	// Pages before the first one are empty
+	plans, err = r.GetAll(10, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []*model.Plan{}, plans)
+	plans, err = r.GetAllByStatus(model.StatusDraft, 10, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []*model.Plan{}, plans)
+}
+
+func TestPlanRepo_Batch(t *testing.T) {
+	r := repo.NewPlanRepo(&testTime{})
+	_, err := r.Create(&model.Plan{Name: "Test plan"})
+	assert.NoError(t, err)
+
+	// Best-effort applies what it can
+	results, err := r.Batch([]model.BatchOperation{
+		{Op: model.BatchCreate, Plan: &model.Plan{Name: "Second"}},
+		{Op: model.BatchUpdate, ID: 1, Plan: &model.Plan{Name: "First"}},
+		{Op: model.BatchDelete, ID: 1000},
+		{Op: "archive", ID: 1},
+	}, false)
+	assert.NoError(t, err)
+	assert.Len(t, results, 4)
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, 2, results[0].Plan.ID)
+	assert.NoError(t, results[1].Err)
+	assert.ErrorIs(t, results[2].Err, model.ErrNotFound)
+	assert.ErrorIs(t, results[3].Err, model.ErrInvalidOperation)
+
+	plan, err := r.Get(1)
+	assert.NoError(t, err)
+	assert.Equal(t, "First", plan.Name)
+
+	// Atomic rolls everything back on the first failure
+	results, err = r.Batch([]model.BatchOperation{
+		{Op: model.BatchUpdate, ID: 1, Plan: &model.Plan{Name: "Changed"}},
+		{Op: model.BatchDelete, ID: 2},
+		{Op: model.BatchCreate, Plan: &model.Plan{Name: "Third"}},
+		{Op: model.BatchCreate},
+		{Op: model.BatchDelete, ID: 1},
+	}, true)
+	assert.ErrorIs(t, err, model.ErrBatchAborted)
+	assert.ErrorIs(t, results[3].Err, model.ErrInvalidOperation)
+	for _, i := range []int{0, 1, 2, 4} {
+		assert.ErrorIs(t, results[i].Err, model.ErrBatchAborted)
+		assert.Nil(t, results[i].Plan)
+	}
+
+	plans, err := r.GetAll(10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, plans, 2)
+	assert.Equal(t, "First", plans[0].Name)
+	assert.Equal(t, "Second", plans[1].Name)
+
+	// Ids consumed by the rolled back batch are given out again
+	plan, err = r.Create(&model.Plan{Name: "Third"})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, plan.ID)
+}
+
+func TestPlanRepo_Restore(t *testing.T) {
+	r := repo.NewPlanRepo(&testTime{})
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	_, err := r.Restore(&model.Plan{ID: 5, Name: "Five", Status: model.StatusDone, CreatedAt: created})
+	assert.NoError(t, err)
+	_, err = r.Restore(&model.Plan{ID: 2, Name: "Two"})
+	assert.NoError(t, err)
+	_, err = r.Restore(&model.Plan{ID: 3, Name: "Three", Status: "started"})
+	assert.ErrorIs(t, err, model.ErrInvalidStatus)
+
+	_, err = r.Restore(&model.Plan{ID: 5, Name: "Again"})
+	assert.ErrorIs(t, err, model.ErrAlreadyExists)
+	_, err = r.Restore(&model.Plan{Name: "No id"})
+	assert.ErrorIs(t, err, model.ErrInvalidOperation)
+
+	plans, err := r.GetAll(10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, plans, 2)
+	assert.Equal(t, 2, plans[0].ID)
+	assert.Equal(t, (&testTime{}).Now(), plans[0].CreatedAt)
+	assert.Equal(t, model.StatusDraft, plans[0].Status)
+	assert.Equal(t, 5, plans[1].ID)
+	// Restored plans keep their status, unlike created ones
+	assert.Equal(t, model.StatusDone, plans[1].Status)
+	assert.Equal(t, created, plans[1].CreatedAt)
+	assert.Equal(t, created, plans[1].UpdatedAt)
+
+	// New plans continue after the highest restored id
+	plan, err := r.Create(&model.Plan{Name: "Six"})
+	assert.NoError(t, err)
+	assert.Equal(t, 6, plan.ID)
+}
+
+func TestPlanRepo_Copies(t *testing.T) {
+	r := repo.NewPlanRepo(&testTime{})
+
+	// Callers keep their plans
+	in := &model.Plan{Name: "Test plan"}
+	created, err := r.Create(in)
+	assert.NoError(t, err)
+	assert.Zero(t, in.ID)
+	in.Name = "changed"
+
+	created.Name = "changed"
+	got, err := r.Get(created.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Test plan", got.Name)
+
+	got.Name = "changed"
+	all, err := r.GetAll(10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "Test plan", all[0].Name)
+	all[0].Name = "changed"
+
+	// Updates return the stored plan
+	update := &model.Plan{ID: created.ID, Name: "Renamed"}
+	updated, err := r.Update(update)
+	assert.NoError(t, err)
+	assert.NotSame(t, update, updated)
+	assert.Equal(t, "Renamed", updated.Name)
+	assert.Equal(t, created.CreatedAt, updated.CreatedAt)
+
+	restore := &model.Plan{ID: 9, Name: "Restored"}
+	restored, err := r.Restore(restore)
+	assert.NoError(t, err)
+	assert.True(t, restore.CreatedAt.IsZero())
+	restored.Name = "changed"
+	got, err = r.Get(9)
+	assert.NoError(t, err)
+	assert.Equal(t, "Restored", got.Name)
+
+	results, err := r.Batch([]model.BatchOperation{{Op: model.BatchUpdate, ID: 9, Plan: &model.Plan{Name: "Batch"}}}, false)
+	assert.NoError(t, err)
+	results[0].Plan.Name = "changed"
+	got, err = r.Get(9)
+	assert.NoError(t, err)
+	assert.Equal(t, "Batch", got.Name)
+	assert.Equal(t, got.CreatedAt, results[0].Plan.CreatedAt)
+}
+
+// TestPlanRepo_Concurrent is meant for the race detector: go test -race ./repo
+func TestPlanRepo_Concurrent(t *testing.T) {
+	r := repo.NewPlanRepo(nil)
+	const workers, rounds = 8, 200
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				p, err := r.Create(&model.Plan{Name: fmt.Sprintf("plan %d-%d", w, i)})
+				if !assert.NoError(t, err) {
+					return
+				}
+
+				// Readers modify what they get, it's their copy
+				if got, err := r.Get(p.ID); err == nil {
+					got.Name = "mine"
+				}
+				plans, err := r.GetAll(20, i%5)
+				assert.NoError(t, err)
+				for _, plan := range plans {
+					plan.Description = "mine"
+				}
+
+				_, _ = r.Update(&model.Plan{ID: p.ID, Name: "updated", Description: "by " + strconv.Itoa(w)})
+				_, _ = r.Batch([]model.BatchOperation{
+					{Op: model.BatchCreate, Plan: &model.Plan{Name: "batch"}},
+					{Op: model.BatchDelete, ID: p.ID - 1},
+				}, i%2 == 0)
+				_, _ = r.Restore(&model.Plan{ID: 100000 + w*rounds + i})
+				if i%3 == 0 {
+					_ = r.Delete(p.ID)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// The listing stays sorted, without duplicates, and nothing leaked out
+	plans, err := r.GetAll(100000, 0)
+	assert.NoError(t, err)
+	for i, p := range plans {
+		assert.NotEqual(t, "mine", p.Name)
+		assert.NotEqual(t, "mine", p.Description)
+		if i > 0 {
+			assert.Less(t, plans[i-1].ID, p.ID)
+		}
+	}
+}
+
+func TestPlanRepo_Transition(t *testing.T) {
+	r := repo.NewPlanRepo(&testTime{})
+	sm := model.DefaultStateMachine()
+
+	plan, err := r.Create(&model.Plan{Name: "Test plan"})
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusDraft, plan.Status)
+	other, err := r.Create(&model.Plan{Name: "Active plan", Status: model.StatusDraft})
+	assert.NoError(t, err)
+	_, err = r.Create(&model.Plan{Name: "Bad plan", Status: model.StatusActive})
+	assert.ErrorIs(t, err, model.ErrInvalidOperation)
+	assert.EqualError(t, err, "invalid operation: new plans start in draft")
+	_, err = r.Create(&model.Plan{Name: "Bad plan", Status: "started"})
+	assert.ErrorIs(t, err, model.ErrInvalidOperation)
+	_, err = r.Transition(other.ID, model.StatusActive, sm)
+	assert.NoError(t, err)
+
+	plan, err = r.Transition(plan.ID, model.StatusActive, sm)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusActive, plan.Status)
+	assert.Equal(t, []model.StatusTransition{{From: model.StatusDraft, To: model.StatusActive, At: (&testTime{}).Now()}}, plan.Transitions)
+
+	_, err = r.Transition(plan.ID, model.StatusDraft, sm)
+	assert.ErrorIs(t, err, model.ErrIllegalTransition)
+	assert.EqualError(t, err, "illegal status transition from active to draft")
+	_, err = r.Transition(100, model.StatusActive, sm)
+	assert.ErrorIs(t, err, model.ErrNotFound)
+
+	// Updates keep the status and its history, and can't change the status
+	_, err = r.Update(&model.Plan{ID: plan.ID, Name: "Renamed", Status: model.StatusDone})
+	assert.ErrorIs(t, err, model.ErrInvalidOperation)
+	assert.EqualError(t, err, "invalid operation: the status changes by transition only")
+	plan, err = r.Update(&model.Plan{ID: plan.ID, Name: "Renamed", Status: model.StatusActive})
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusActive, plan.Status)
+	assert.Len(t, plan.Transitions, 1)
+	plan, err = r.Update(&model.Plan{ID: plan.ID, Name: "Renamed again"})
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusActive, plan.Status)
+
+	active, err := r.GetAllByStatus(model.StatusActive, 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, active, 2)
+	active, err = r.GetAllByStatus(model.StatusActive, 1, 1)
+	assert.NoError(t, err)
+	assert.Len(t, active, 1)
+	assert.Equal(t, "Active plan", active[0].Name)
+	drafts, err := r.GetAllByStatus(model.StatusDraft, 10, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, drafts)
+}
+
+func TestParseStateMachine(t *testing.T) {
+	sm, err := model.ParseStateMachine("draft:active ; active:done,cancelled")
+	assert.NoError(t, err)
+	assert.True(t, sm.Allows(model.StatusDraft, model.StatusActive))
+	assert.True(t, sm.Allows(model.StatusActive, model.StatusCancelled))
+	assert.False(t, sm.Allows(model.StatusDraft, model.StatusDone))
+	assert.Equal(t, "draft:active;active:done,cancelled", sm.String())
+
+	_, err = model.ParseStateMachine("draft:started")
+	assert.ErrorIs(t, err, model.ErrInvalidStatus)
+	_, err = model.ParseStateMachine("draft")
+	assert.Error(t, err)
+
+	// The default transitions round trip
+	sm, err = model.ParseStateMachine(model.DefaultStateMachine().String())
+	assert.NoError(t, err)
+	assert.Equal(t, model.DefaultStateMachine(), sm)
 }
@@ -125,3 +125,112 @@ func BenchmarkParam(b *testing.B) {
 		Param(req, "key")
 	}
 }
+
+// discardWriter is a http.ResponseWriter that doesn't allocate, so allocations
+// reported by the benchmarks below come from the router only.
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
+func noop(w http.ResponseWriter, r *http.Request) {}
+
+func passthrough(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+	})
+}
+
+// staticDispatcher builds a dispatcher with middleware at every level and a few static routes.
+func staticDispatcher() Dispatcher {
+	r := New("/v1")
+	r.Wrap(passthrough)
+	r.Add("/health", http.HandlerFunc(noop))
+	r.Group("/plan", func(r Router) {
+		r.Wrap(passthrough)
+		r.Wrap(passthrough)
+		r.Add("/", http.HandlerFunc(noop))
+		r.Add("/export", http.HandlerFunc(noop))
+	})
+
+	d := Build(r)
+	d.Wrap(passthrough)
+
+	return d
+}
+
+func BenchmarkStaticMatchWithMiddleware(b *testing.B) {
+	r := New("/v1")
+	r.Wrap(passthrough)
+	r.Wrap(passthrough)
+	r.Add("/some/path/to/match", http.HandlerFunc(noop))
+
+	req, _ := http.NewRequest("GET", "http://test.com/v1/some/path/to/match", nil)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Match(req)
+	}
+}
+
+func BenchmarkStaticDispatchWithMiddleware(b *testing.B) {
+	d := staticDispatcher()
+
+	req, _ := http.NewRequest("GET", "http://test.com/v1/plan/export", nil)
+	res := &discardWriter{header: make(http.Header)}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d.ServeHTTP(res, req)
+	}
+}
+
+func TestStaticDispatchAllocs(t *testing.T) {
+	d := staticDispatcher()
+	res := &discardWriter{header: make(http.Header)}
+
+	for _, url := range []string{"http://test.com/v1/health", "http://test.com/v1/plan", "http://test.com/v1/plan/export"} {
+		req, _ := http.NewRequest("GET", url, nil)
+		if allocs := testing.AllocsPerRun(100, func() { d.ServeHTTP(res, req) }); allocs != 0 {
+			t.Errorf("%s: dispatching a static route should not allocate. Got %v allocs", url, allocs)
+		}
+	}
+}
+
+func TestWrapRebuildsChain(t *testing.T) {
+	r := New("/")
+	r.Add("/", http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("Handler"))
+	}))
+	d := Build(r)
+
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Body.String() != "Handler" {
+		t.Errorf("Response body isn't as expected: %s", w.Body.String())
+	}
+
+	r.Wrap(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.Write([]byte("1"))
+			next.ServeHTTP(res, req)
+		})
+	})
+	d.Wrap(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.Write([]byte("0"))
+			next.ServeHTTP(res, req)
+		})
+	})
+
+	w = httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Body.String() != "01Handler" {
+		t.Errorf("Response body isn't as expected after Wrap: %s", w.Body.String())
+	}
+}
@@ -0,0 +1,378 @@
+package router
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Compressor is a content coding usable by the compression middleware, such as
+// gzip. Other codings, e.g. brotli, plug in by implementing it.
+type Compressor interface {
+	// Encoding returns the content coding token, e.g. "gzip".
+	Encoding() string
+
+	// NewWriter returns a writer compressing into w. Close writes the remaining
+	// data, without closing w.
+	NewWriter(w io.Writer) io.WriteCloser
+}
+
+// Gzip is the gzip Compressor. Level is a compress/gzip level, the default one if 0.
+type Gzip struct {
+	Level int
+}
+
+func (Gzip) Encoding() string {
+	return "gzip"
+}
+
+var gzipPools sync.Map
+
+func (g Gzip) NewWriter(w io.Writer) io.WriteCloser {
+	p, _ := gzipPools.LoadOrStore(g.Level, &sync.Pool{})
+	pool := p.(*sync.Pool)
+
+	zw, ok := pool.Get().(*gzip.Writer)
+	if ok {
+		zw.Reset(w)
+	} else if zw, ok = newGzipWriter(w, g.Level); !ok {
+		zw = gzip.NewWriter(w)
+	}
+
+	return &pooledWriter{writeFlusher: zw, pool: pool}
+}
+
+func newGzipWriter(w io.Writer, level int) (*gzip.Writer, bool) {
+	if level == 0 {
+		return gzip.NewWriter(w), true
+	}
+
+	zw, err := gzip.NewWriterLevel(w, level)
+	return zw, err == nil
+}
+
+// Deflate is the deflate Compressor. HTTP's deflate is the zlib format (RFC 1950),
+// not a raw deflate stream. Level is a compress/zlib level, the default one if 0.
+type Deflate struct {
+	Level int
+}
+
+func (Deflate) Encoding() string {
+	return "deflate"
+}
+
+var deflatePools sync.Map
+
+func (d Deflate) NewWriter(w io.Writer) io.WriteCloser {
+	p, _ := deflatePools.LoadOrStore(d.Level, &sync.Pool{})
+	pool := p.(*sync.Pool)
+
+	zw, ok := pool.Get().(*zlib.Writer)
+	if ok {
+		zw.Reset(w)
+	} else if zw, ok = newZlibWriter(w, d.Level); !ok {
+		zw = zlib.NewWriter(w)
+	}
+
+	return &pooledWriter{writeFlusher: zw, pool: pool}
+}
+
+func newZlibWriter(w io.Writer, level int) (*zlib.Writer, bool) {
+	if level == 0 {
+		return zlib.NewWriter(w), true
+	}
+
+	zw, err := zlib.NewWriterLevel(w, level)
+	return zw, err == nil
+}
+
+type writeFlusher interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// pooledWriter returns its compressor to the pool once closed.
+type pooledWriter struct {
+	writeFlusher
+	pool *sync.Pool
+}
+
+func (w *pooledWriter) Close() error {
+	err := w.writeFlusher.Close()
+	w.pool.Put(w.writeFlusher)
+
+	return err
+}
+
+// CompressOptions configures the compression middleware.
+type CompressOptions struct {
+	// Compressors in order of preference, gzip and deflate if empty.
+	Compressors []Compressor
+
+	// MinSize is the smallest body compressed, 1024 bytes if 0.
+	MinSize int
+
+	// SkipTypes lists the media types sent as is, a type ending with "/" covers
+	// every subtype. Images, audio, video and archives if empty.
+	SkipTypes []string
+}
+
+var defaultSkipTypes = []string{
+	"image/", "audio/", "video/",
+	"application/gzip", "application/x-gzip", "application/zip",
+	"application/zstd", "application/x-7z-compressed", "application/x-rar-compressed",
+	"application/pdf", "application/octet-stream",
+}
+
+// Compress returns a Middleware compressing the response bodies with the coding
+// preferred by the Accept-Encoding header. Bodies smaller than the minimum size,
+// responses of the skipped types and responses with a Content-Encoding are sent
+// as is. The response writer keeps supporting http.Flusher and http.Hijacker.
+func Compress(opts CompressOptions) Middleware {
+	if len(opts.Compressors) == 0 {
+		opts.Compressors = []Compressor{Gzip{}, Deflate{}}
+	}
+	if opts.MinSize <= 0 {
+		opts.MinSize = 1024
+	}
+	if len(opts.SkipTypes) == 0 {
+		opts.SkipTypes = defaultSkipTypes
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			c := negotiateEncoding(r.Header.Get("Accept-Encoding"), opts.Compressors)
+			if c == nil || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Not deferred, a panicking handler leaves the response to the recovery
+			cw := &compressWriter{ResponseWriter: w, opts: &opts, compressor: c}
+			next.ServeHTTP(cw, r)
+			_ = cw.close()
+		})
+	}
+}
+
+// negotiateEncoding returns the compressor with the highest quality in an
+// Accept-Encoding value, the first one on ties, nil if none is accepted.
+func negotiateEncoding(accept string, compressors []Compressor) Compressor {
+	var best Compressor
+	bestQ := 0.0
+	anyQ := -1.0
+	qs := make(map[string]float64)
+
+	for _, part := range strings.Split(accept, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+
+		q := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			var err error
+			if q, err = strconv.ParseFloat(params[2:], 64); err != nil {
+				continue
+			}
+		}
+
+		if coding == "*" {
+			anyQ = q
+		} else {
+			qs[coding] = q
+		}
+	}
+
+	for _, c := range compressors {
+		q, ok := qs[c.Encoding()]
+		if !ok {
+			q = anyQ
+		}
+		if q > bestQ {
+			best, bestQ = c, q
+		}
+	}
+
+	return best
+}
+
+// compressWriter buffers the beginning of the body until it knows if it's worth
+// compressing it: once MinSize bytes are written, on Flush or at the end.
+type compressWriter struct {
+	http.ResponseWriter
+	opts       *CompressOptions
+	compressor Compressor
+
+	status  int
+	buf     bytes.Buffer
+	decided bool
+	zw      io.WriteCloser
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.decided || w.status != 0 {
+		return
+	}
+
+	// Informational responses aren't final
+	if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	w.status = status
+	if !bodyAllowed(status) {
+		w.decide(false)
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if !w.decided {
+		w.buf.Write(b)
+		if w.buf.Len() < w.opts.MinSize {
+			return len(b), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	if w.zw != nil {
+		return w.zw.Write(b)
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+// decide sends the header, compressing the body if worth is set and the
+// response is eligible, then writes the buffered body.
+func (w *compressWriter) decide(worth bool) error {
+	w.decided = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	// Sniffed from the buffered body as the written one may be compressed
+	h := w.Header()
+	if h.Get("Content-Type") == "" && w.buf.Len() > 0 {
+		h.Set("Content-Type", http.DetectContentType(w.buf.Bytes()))
+	}
+
+	if worth && w.eligible() {
+		h.Set("Content-Encoding", w.compressor.Encoding())
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		w.zw = w.compressor.NewWriter(w.ResponseWriter)
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.buf.Len() == 0 {
+		return nil
+	}
+
+	var err error
+	if w.zw != nil {
+		_, err = w.zw.Write(w.buf.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf.Bytes())
+	}
+	w.buf.Reset()
+
+	return err
+}
+
+// eligible reports if the response may be compressed.
+func (w *compressWriter) eligible() bool {
+	h := w.Header()
+	if !bodyAllowed(w.status) || h.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return true
+	}
+
+	for _, skip := range w.opts.SkipTypes {
+		if mediaType == skip || strings.HasSuffix(skip, "/") && strings.HasPrefix(mediaType, skip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Flush sends the buffered body, compressed if eligible whatever its size as
+// the response is streamed.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		if err := w.decide(true); err != nil {
+			return
+		}
+	}
+
+	if f, ok := w.zw.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return
+		}
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hands the connection over, the response isn't written by the middleware anymore.
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("router: the response writer doesn't support hijacking")
+	}
+
+	w.decided = true
+	return h.Hijack()
+}
+
+// close ends the response once the handler returned.
+func (w *compressWriter) close() error {
+	if !w.decided {
+		// Nothing written at all stays so, an empty body isn't compressed
+		if w.status == 0 && w.buf.Len() == 0 {
+			return nil
+		}
+		if err := w.decide(false); err != nil {
+			return err
+		}
+	}
+
+	if w.zw != nil {
+		return w.zw.Close()
+	}
+
+	return nil
+}
+
+// bodyAllowed reports if a response with status may have a body.
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
@@ -0,0 +1,200 @@
+package router
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	compressors := []Compressor{Gzip{}, Deflate{}}
+	for accept, want := range map[string]string{
+		"":                        "",
+		"gzip":                    "gzip",
+		"deflate, gzip":           "gzip",
+		"gzip;q=0.5, deflate":     "deflate",
+		"br, DEFLATE;q=0.8":       "deflate",
+		"*":                       "gzip",
+		"*;q=0.3, gzip;q=0":       "deflate",
+		"identity":                "",
+		"gzip;q=0, deflate;q=0.0": "",
+		"gzip;q=x, deflate":       "deflate",
+	} {
+		got := ""
+		if c := negotiateEncoding(accept, compressors); c != nil {
+			got = c.Encoding()
+		}
+		if got != want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", accept, got, want)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	long := strings.Repeat("a plan with a long description, ", 64)
+
+	r := New("/")
+	r.Add("/long", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, long[:100])
+		_, _ = io.WriteString(w, long[100:])
+	}))
+	r.Add("/short", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "short")
+	}))
+	r.Add("/image", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = io.WriteString(w, long)
+	}))
+	r.Add("/encoded", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		_, _ = io.WriteString(w, long)
+	}))
+	r.Add("/created", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Length", "2048")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, long)
+	}))
+	r.Add("/empty", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	r.Wrap(Compress(CompressOptions{MinSize: 512}))
+
+	d := Build(r)
+	for _, tc := range []struct {
+		target, accept string
+		status         int
+		encoding       string
+		contentType    string
+	}{
+		{target: "/long", accept: "gzip, deflate", status: 200, encoding: "gzip", contentType: "application/json"},
+		{target: "/long", accept: "deflate", status: 200, encoding: "deflate", contentType: "application/json"},
+		{target: "/long", accept: "br", status: 200, contentType: "application/json"},
+		{target: "/long", status: 200, contentType: "application/json"},
+		{target: "/short", accept: "gzip", status: 200, contentType: "text/plain; charset=utf-8"},
+		{target: "/image", accept: "gzip", status: 200, contentType: "image/png"},
+		{target: "/encoded", accept: "deflate", status: 200, encoding: "gzip"},
+		{target: "/created", accept: "gzip", status: 201, encoding: "gzip", contentType: "text/plain; charset=utf-8"},
+		{target: "/empty", accept: "gzip", status: 204},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+		if tc.accept != "" {
+			req.Header.Set("Accept-Encoding", tc.accept)
+		}
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, req)
+
+		res := w.Result()
+		if res.StatusCode != tc.status {
+			t.Errorf("%s %q: status %d, want %d", tc.target, tc.accept, res.StatusCode, tc.status)
+		}
+		if got := res.Header.Get("Content-Encoding"); got != tc.encoding {
+			t.Errorf("%s %q: Content-Encoding %q, want %q", tc.target, tc.accept, got, tc.encoding)
+		}
+		if got := res.Header.Get("Content-Type"); tc.contentType != "" && got != tc.contentType {
+			t.Errorf("%s %q: Content-Type %q, want %q", tc.target, tc.accept, got, tc.contentType)
+		}
+		if got := res.Header.Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("%s %q: Vary %q", tc.target, tc.accept, got)
+		}
+
+		if tc.encoding != "" && tc.target != "/encoded" {
+			if got := res.Header.Get("Content-Length"); got != "" {
+				t.Errorf("%s %q: Content-Length %q kept", tc.target, tc.accept, got)
+			}
+			if body := decompress(t, tc.encoding, res.Body); body != long {
+				t.Errorf("%s %q: body %q", tc.target, tc.accept, body)
+			}
+		}
+	}
+}
+
+func decompress(t *testing.T, encoding string, r io.Reader) string {
+	t.Helper()
+
+	var zr io.Reader
+	switch encoding {
+	case "gzip":
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr = gr
+	case "deflate":
+		fr, err := zlib.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr = fr
+	}
+
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(b)
+}
+
+// hijackRecorder is a ResponseRecorder supporting hijacking.
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (w *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijacked = true
+	return nil, nil, nil
+}
+
+func TestCompressWriterInterfaces(t *testing.T) {
+	var flushed []string
+	h := Compress(CompressOptions{})(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range []string{"data: one\n\n", "data: two\n\n"} {
+			_, _ = io.WriteString(w, event)
+			w.(http.Flusher).Flush()
+			flushed = append(flushed, event)
+		}
+
+		if _, _, err := w.(http.Hijacker).Hijack(); err != nil {
+			t.Errorf("Hijack: %v", err)
+		}
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+	h.ServeHTTP(w, req)
+
+	if !w.Flushed || !w.hijacked {
+		t.Errorf("flushed %v, hijacked %v", w.Flushed, w.hijacked)
+	}
+	if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding %q", got)
+	}
+
+	// Flushed events are readable before the end of the stream
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, len(strings.Join(flushed, "")))
+	if _, err := io.ReadFull(zr, b); err != nil || string(b) != strings.Join(flushed, "") {
+		t.Errorf("streamed body %q, %v", b, err)
+	}
+
+	// Without hijacking support
+	h = Compress(CompressOptions{})(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if _, _, err := w.(http.Hijacker).Hijack(); err == nil {
+			t.Error("Hijack: no error")
+		}
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), req)
+}
@@ -0,0 +1,60 @@
+package router
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// constraint validates the value of a route parameter.
+type constraint func(string) bool
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// constraints are the named constraints usable as ":name<kind>".
+// Anything else between the angle brackets is a regular expression that must
+// match the whole path part, e.g. ":slug<[a-z-]+>".
+var constraints = map[string]constraint{
+	"int":  isInt,
+	"uuid": uuidPattern.MatchString,
+}
+
+// isInt reports if s is an int written with ASCII digits only, so signs such as
+// "+5" don't give a second URL to the resource of "5".
+func isInt(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+
+	// Digits too many for an int
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+// parseParam splits a parameter definition such as "id<int>" into its name and
+// constraint. It panics on an invalid regular expression, like a conflicting
+// route, it's a programming error found at registration.
+func parseParam(def string) (string, constraint) {
+	i := strings.IndexByte(def, '<')
+	if i < 0 || def[len(def)-1] != '>' {
+		return def, nil
+	}
+
+	name, expr := def[:i], def[i+1:len(def)-1]
+	if c, ok := constraints[expr]; ok {
+		return name, c
+	}
+
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		panic(fmt.Sprintf("router: invalid constraint for param %q: %v", name, err))
+	}
+
+	return name, re.MatchString
+}
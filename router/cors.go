@@ -0,0 +1,206 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSPolicy configures the CORS middleware.
+type CORSPolicy struct {
+	// AllowedOrigins lists the origins allowed to call the routes, exact such as
+	// "https://plan.example.com" or with a wildcard such as "https://*.example.com".
+	// "*" allows any origin.
+	AllowedOrigins []string
+
+	// AllowedMethods lists the methods allowed in preflight requests, the methods
+	// registered for the route path if empty.
+	AllowedMethods []string
+
+	// AllowedHeaders lists the request headers allowed in preflight requests,
+	// "*" allowing any header.
+	AllowedHeaders []string
+
+	// ExposedHeaders lists the response headers readable by the browser.
+	ExposedHeaders []string
+
+	// AllowCredentials allows cookies and authorization headers. It can't be
+	// combined with the "*" origin, which would let any site make credentialed
+	// requests: list the trusted origins instead.
+	AllowCredentials bool
+
+	// MaxAge is how long browsers may cache a preflight response, if set.
+	MaxAge time.Duration
+}
+
+// CORS returns a Middleware applying policy. Preflight requests, OPTIONS requests
+// with an Access-Control-Request-Method header, are answered without calling the
+// next handler: 204 if allowed, 403 otherwise. Requests of other origins go through
+// without CORS headers, the browser blocks their response.
+//
+// Wrapped around a router, a group or a single route, preflight requests are
+// answered for every path with a route, as OPTIONS requests run the route middleware.
+// Nested CORS middleware all apply, so each route should get a single policy.
+//
+// CORS panics if policy allows credentials for any origin.
+func CORS(policy CORSPolicy) Middleware {
+	c := &cors{
+		policy:  policy,
+		methods: strings.Join(policy.AllowedMethods, ", "),
+		exposed: strings.Join(policy.ExposedHeaders, ", "),
+	}
+	if policy.MaxAge > 0 {
+		c.maxAge = strconv.Itoa(int(policy.MaxAge / time.Second))
+	}
+
+	for _, h := range policy.AllowedHeaders {
+		if h == "*" {
+			c.anyHeader = true
+		}
+	}
+
+	if policy.AllowCredentials && c.anyOrigin() {
+		panic(`router: CORS credentials can't be allowed for the "*" origin`)
+	}
+
+	return c.wrap
+}
+
+type cors struct {
+	policy    CORSPolicy
+	methods   string
+	exposed   string
+	maxAge    string
+	anyHeader bool
+}
+
+func (c *cors) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		if preflight {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		allowed := c.allowOrigin(origin)
+		if !allowed {
+			if preflight {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if c.anyOrigin() {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if c.policy.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if c.exposed != "" {
+				h.Set("Access-Control-Expose-Headers", c.exposed)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		methods := c.methods
+		if methods == "" {
+			methods = strings.Join(AllowedMethods(r), ", ")
+		}
+		if !containsToken(methods, r.Header.Get("Access-Control-Request-Method"), false) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+			if !c.allowHeaders(requested) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			h.Set("Access-Control-Allow-Headers", requested)
+		}
+
+		h.Set("Access-Control-Allow-Methods", methods)
+		if c.maxAge != "" {
+			h.Set("Access-Control-Max-Age", c.maxAge)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func (c *cors) anyOrigin() bool {
+	for _, o := range c.policy.AllowedOrigins {
+		if o == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allowOrigin reports if origin matches an allowed origin. A wildcard matches
+// one or more characters, e.g. "https://*.example.com" matches
+// "https://app.example.com" but not "https://example.com".
+func (c *cors) allowOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, o := range c.policy.AllowedOrigins {
+		o = strings.ToLower(o)
+		if o == "*" || o == origin {
+			return true
+		}
+
+		if i := strings.IndexByte(o, '*'); i >= 0 {
+			prefix, suffix := o[:i], o[i+1:]
+			if len(origin) > len(prefix)+len(suffix) &&
+				strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// allowHeaders reports if every header of the comma separated list is allowed.
+func (c *cors) allowHeaders(requested string) bool {
+	if c.anyHeader {
+		return true
+	}
+
+	allowed := strings.Join(c.policy.AllowedHeaders, ",")
+	for _, h := range strings.Split(requested, ",") {
+		if h = strings.TrimSpace(h); h != "" && !containsToken(allowed, h, true) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// containsToken reports if the comma separated list has token.
+func containsToken(list, token string, fold bool) bool {
+	for _, t := range strings.Split(list, ",") {
+		t = strings.TrimSpace(t)
+		if t == token || fold && strings.EqualFold(t, token) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,211 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	r := New("/v1")
+	r.Group("/plan", func(g Router) {
+		g.Wrap(CORS(CORSPolicy{
+			AllowedOrigins: []string{"https://dashboard.example.com", "https://*.preview.example.com"},
+			AllowedHeaders: []string{"Content-Type", "Authorization"},
+			ExposedHeaders: []string{"X-Request-Id"},
+			MaxAge:         10 * time.Minute,
+		}))
+		g.Handle(http.MethodGet, "/", http.HandlerFunc(dhandler))
+		g.Handle(http.MethodPost, "/", http.HandlerFunc(dhandler))
+	})
+
+	// Per route policies
+	r.Handle(http.MethodGet, "/public", http.HandlerFunc(dhandler)).Wrap(CORS(CORSPolicy{
+		AllowedOrigins: []string{"*"},
+	}))
+	r.Handle(http.MethodGet, "/account", http.HandlerFunc(dhandler)).Wrap(CORS(CORSPolicy{
+		AllowedOrigins:   []string{"https://dashboard.example.com"},
+		AllowCredentials: true,
+	}))
+
+	d := Build(r)
+	for _, tc := range []struct {
+		name    string
+		method  string
+		target  string
+		headers map[string]string
+		status  int
+		want    map[string]string
+	}{
+		{
+			name:   "preflight",
+			method: "OPTIONS", target: "/v1/plan",
+			headers: map[string]string{
+				"Origin":                         "https://dashboard.example.com",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "content-type, authorization",
+			},
+			status: http.StatusNoContent,
+			want: map[string]string{
+				"Access-Control-Allow-Origin":  "https://dashboard.example.com",
+				"Access-Control-Allow-Methods": "GET, HEAD, OPTIONS, POST",
+				"Access-Control-Allow-Headers": "content-type, authorization",
+				"Access-Control-Max-Age":       "600",
+				"Vary":                         "Origin",
+			},
+		},
+		{
+			name:   "wildcard origin",
+			method: "OPTIONS", target: "/v1/plan",
+			headers: map[string]string{
+				"Origin":                        "https://pr-12.preview.example.com",
+				"Access-Control-Request-Method": "GET",
+			},
+			status: http.StatusNoContent,
+			want:   map[string]string{"Access-Control-Allow-Origin": "https://pr-12.preview.example.com"},
+		},
+		{
+			name:   "wildcard needs a subdomain",
+			method: "OPTIONS", target: "/v1/plan",
+			headers: map[string]string{
+				"Origin":                        "https://.preview.example.com",
+				"Access-Control-Request-Method": "GET",
+			},
+			status: http.StatusForbidden,
+			want:   map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:   "method not registered",
+			method: "OPTIONS", target: "/v1/plan",
+			headers: map[string]string{
+				"Origin":                        "https://dashboard.example.com",
+				"Access-Control-Request-Method": "DELETE",
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "header not allowed",
+			method: "OPTIONS", target: "/v1/plan",
+			headers: map[string]string{
+				"Origin":                         "https://dashboard.example.com",
+				"Access-Control-Request-Method":  "GET",
+				"Access-Control-Request-Headers": "X-Secret",
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "plain options",
+			method: "OPTIONS", target: "/v1/plan",
+			status: http.StatusNoContent,
+			want:   map[string]string{"Allow": "GET, HEAD, OPTIONS, POST", "Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:   "actual request",
+			method: "GET", target: "/v1/plan",
+			headers: map[string]string{"Origin": "https://dashboard.example.com"},
+			status:  http.StatusOK,
+			want: map[string]string{
+				"Access-Control-Allow-Origin":   "https://dashboard.example.com",
+				"Access-Control-Expose-Headers": "X-Request-Id",
+				"Access-Control-Allow-Methods":  "",
+			},
+		},
+		{
+			name:   "other origin",
+			method: "GET", target: "/v1/plan",
+			headers: map[string]string{"Origin": "https://evil.example.org"},
+			status:  http.StatusOK,
+			want:    map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:   "route policy for any origin",
+			method: "GET", target: "/v1/public",
+			headers: map[string]string{"Origin": "https://evil.example.org"},
+			status:  http.StatusOK,
+			want: map[string]string{
+				"Access-Control-Allow-Origin":      "*",
+				"Access-Control-Allow-Credentials": "",
+			},
+		},
+		{
+			name:   "route policy with credentials",
+			method: "GET", target: "/v1/account",
+			headers: map[string]string{"Origin": "https://dashboard.example.com"},
+			status:  http.StatusOK,
+			want: map[string]string{
+				"Access-Control-Allow-Origin":      "https://dashboard.example.com",
+				"Access-Control-Allow-Credentials": "true",
+			},
+		},
+		{
+			name:   "route policy preflight",
+			method: "OPTIONS", target: "/v1/public",
+			headers: map[string]string{
+				"Origin":                        "https://evil.example.org",
+				"Access-Control-Request-Method": "GET",
+			},
+			status: http.StatusNoContent,
+			want:   map[string]string{"Access-Control-Allow-Methods": "GET, HEAD, OPTIONS"},
+		},
+	} {
+		req := httptest.NewRequest(tc.method, tc.target, nil)
+		for k, v := range tc.headers {
+			req.Header.Set(k, v)
+		}
+		res := httptest.NewRecorder()
+		d.ServeHTTP(res, req)
+
+		if res.Code != tc.status {
+			t.Errorf("%s: got status %d, want %d", tc.name, res.Code, tc.status)
+		}
+		for k, v := range tc.want {
+			if got := res.Header().Get(k); got != v {
+				t.Errorf("%s: got %s %q, want %q", tc.name, k, got, v)
+			}
+		}
+	}
+}
+
+func TestCORSCredentialsForAnyOrigin(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Allowing credentials for any origin should panic")
+		}
+	}()
+
+	CORS(CORSPolicy{AllowedOrigins: []string{"https://a.example.com", "*"}, AllowCredentials: true})
+}
+
+func TestRouteMiddleware(t *testing.T) {
+	r := New("/")
+	r.Wrap(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.Write([]byte("router "))
+			next.ServeHTTP(res, req)
+		})
+	})
+	r.Add("/a", http.HandlerFunc(dhandler)).Wrap(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.Write([]byte("route "))
+			next.ServeHTTP(res, req)
+		})
+	})
+	r.Add("/b", http.HandlerFunc(dhandler))
+
+	d := Build(r)
+	for target, want := range map[string]string{
+		"/a": "router route Hello test!",
+		"/b": "router Hello test!",
+	} {
+		res := httptest.NewRecorder()
+		d.ServeHTTP(res, httptest.NewRequest("GET", target, nil))
+		if res.Body.String() != want {
+			t.Errorf("%s: got %q, want %q", target, res.Body.String(), want)
+		}
+	}
+
+	if mw := r.Routes()[0].Middleware; len(mw) != 2 {
+		t.Errorf("Route middleware should be listed: %v", mw)
+	}
+}
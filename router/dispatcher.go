@@ -2,6 +2,7 @@ package router
 
 import (
 	"net/http"
+	"strings"
 )
 
 // Dispatcher is constructed by Route() and works as a replacement
@@ -13,19 +14,43 @@ type Dispatcher interface {
 	// Add inserts a Router to the end of the Dispatcher's queue
 	Add(r Router)
 
+	// Mount inserts an http.Handler, e.g. another Dispatcher, for prefix and every path below it
+	// to the end of the Dispatcher's queue. The prefix is removed from the request path.
+	Mount(prefix string, h http.Handler)
+
 	// Wrap takes a Middleware to wrap all handlers in order (from inside out) at dispatcher level.
+	// Dispatcher middleware runs around the handler of the matched route, or of the NotFound
+	// and MethodNotAllowed handlers, after matching. The chains are compiled into the routes,
+	// so a router is meant to be served by a single dispatcher.
 	Wrap(Middleware)
+
+	// NotFound sets the handler for requests no router matches, 404 without body by default.
+	// Like the MethodNotAllowed handler, it runs inside the dispatcher middleware.
+	NotFound(http.Handler)
+
+	// MethodNotAllowed sets the handler for requests matching a route path but none of its
+	// methods, 405 without body by default. The Allow header is set before it runs.
+	MethodNotAllowed(http.Handler)
+
+	// Routes describes the routes of every router in the queue, in queue order.
+	Routes() []RouteInfo
 }
 
 // Build constructs a Dispatcher that implements http.Handler and will contain
 // all routes defined in the Router objects passed as parameters.
 func Build(routes ...Router) Dispatcher {
 	d := &dispatcher{
-		routes:     make([]Router, len(routes)),
-		middleware: make([]Middleware, 0),
+		routes:           make([]Router, len(routes)),
+		middleware:       make([]Middleware, 0),
+		notFound:         statusHandler(http.StatusNotFound),
+		methodNotAllowed: statusHandler(http.StatusMethodNotAllowed),
 	}
 
 	copy(d.routes, routes)
+	for _, r := range d.routes {
+		d.compile(r)
+	}
+	d.compileErrors()
 
 	return d
 }
@@ -33,6 +58,18 @@ func Build(routes ...Router) Dispatcher {
 type dispatcher struct {
 	routes     []Router
 	middleware []Middleware
+
+	notFound         http.Handler
+	methodNotAllowed http.Handler
+
+	// NotFound and MethodNotAllowed handlers wrapped in the middleware
+	notFoundChain         http.Handler
+	methodNotAllowedChain http.Handler
+}
+
+// compiledRouter is a Router compiling the dispatcher middleware into its routes.
+type compiledRouter interface {
+	dispatchWith([]Middleware)
 }
 
 // ServeHTTP implements http.Handler interface.
@@ -43,9 +80,11 @@ func (d *dispatcher) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 		// Found
 		if h := r.Match(req); h != nil {
-			// Add middleware
-			for _, m := range d.middleware {
-				h = m(h)
+			// Add middleware, unless compiled into the route
+			if _, ok := r.(compiledRouter); !ok {
+				for _, m := range d.middleware {
+					h = m(h)
+				}
 			}
 
 			// Dispatch
@@ -55,14 +94,71 @@ func (d *dispatcher) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 			return
 		}
 	}
+
+	// 405 Method Not Allowed
+	for _, r := range d.routes {
+		if allowed := r.Allowed(req); len(allowed) > 0 {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			d.methodNotAllowedChain.ServeHTTP(w, req)
+			return
+		}
+	}
+
 	// 404 Not Found
-	w.WriteHeader(http.StatusNotFound)
+	d.notFoundChain.ServeHTTP(w, req)
+}
+
+// compile rebuilds the handler chains of the routes of r with the dispatcher middleware.
+func (d *dispatcher) compile(r Router) {
+	if cr, ok := r.(compiledRouter); ok {
+		cr.dispatchWith(d.middleware)
+	}
+}
+
+// compileErrors wraps the NotFound and MethodNotAllowed handlers with the dispatcher middleware.
+func (d *dispatcher) compileErrors() {
+	d.notFoundChain, d.methodNotAllowedChain = d.notFound, d.methodNotAllowed
+	for _, m := range d.middleware {
+		d.notFoundChain = m(d.notFoundChain)
+		d.methodNotAllowedChain = m(d.methodNotAllowedChain)
+	}
 }
 
 func (d *dispatcher) Add(r Router) {
 	d.routes = append(d.routes, r)
+	d.compile(r)
 }
 
 func (d *dispatcher) Wrap(m Middleware) {
 	d.middleware = append(d.middleware, m)
+	for _, r := range d.routes {
+		d.compile(r)
+	}
+	d.compileErrors()
+}
+
+func (d *dispatcher) NotFound(h http.Handler) {
+	d.notFound = h
+	d.compileErrors()
+}
+
+func (d *dispatcher) MethodNotAllowed(h http.Handler) {
+	d.methodNotAllowed = h
+	d.compileErrors()
+}
+
+func (d *dispatcher) Routes() []RouteInfo {
+	routes := make([]RouteInfo, 0)
+	for _, r := range d.routes {
+		routes = append(routes, r.Routes()...)
+	}
+
+	return routes
+}
+
+// statusHandler answers status without body.
+func statusHandler(status int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(status)
+	})
 }
@@ -1,9 +1,11 @@
 package router
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -50,6 +52,66 @@ func TestDispatcherParam(t *testing.T) {
 	}
 }
 
+func TestParamsOfFailedMatch(t *testing.T) {
+	// r1 matches the path of the requests but not their method or header
+	r1 := New("/")
+	r1.Handle(http.MethodGet, "/plan/:id", http.HandlerFunc(dhandler))
+	r1.Group("/tenant", func(g Router) {
+		g.Header("X-Tenant", "{tenant}")
+		g.Add("/:name", http.HandlerFunc(dhandler))
+	})
+
+	params := func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte(fmt.Sprint(Params(req))))
+	}
+	r2 := New("/")
+	r2.Handle(http.MethodPost, "/plan/:plan", http.HandlerFunc(params))
+	r2.Add("/tenant/:tenant", http.HandlerFunc(params))
+	d := Build(r1, r2)
+
+	for target, want := range map[string]string{
+		"POST /plan/7":  "map[plan:7]",
+		"GET /tenant/x": "map[tenant:x]",
+	} {
+		method, path, _ := strings.Cut(target, " ")
+		res := httptest.NewRecorder()
+		d.ServeHTTP(res, httptest.NewRequest(method, path, nil))
+		if res.Body.String() != want {
+			t.Errorf("%s: params leaked from the first router: %s", target, res.Body.String())
+		}
+	}
+}
+
+func TestMethodBacktracking(t *testing.T) {
+	r := New("/")
+	r.Handle(http.MethodGet, "/plan/new", http.HandlerFunc(dhandler))
+	r.Handle(http.MethodDelete, "/plan/:id", http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("delete " + Param(req, "id")))
+	}))
+	r.Handle(http.MethodPut, "/files/a", http.HandlerFunc(dhandler))
+	r.Handle(http.MethodPost, "/files/*path", http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("upload " + Param(req, "path")))
+	}))
+	d := Build(r)
+
+	for _, tc := range []struct {
+		method, path string
+		status       int
+		body         string
+	}{
+		{"GET", "/plan/new", http.StatusOK, "Hello test!"},
+		{"DELETE", "/plan/new", http.StatusOK, "delete new"},
+		{"POST", "/files/a", http.StatusOK, "upload a"},
+		{"PATCH", "/plan/new", http.StatusMethodNotAllowed, ""},
+	} {
+		res := httptest.NewRecorder()
+		d.ServeHTTP(res, httptest.NewRequest(tc.method, tc.path, nil))
+		if res.Code != tc.status || res.Body.String() != tc.body {
+			t.Errorf("%s %s: got %d %q, want %d %q", tc.method, tc.path, res.Code, res.Body.String(), tc.status, tc.body)
+		}
+	}
+}
+
 func TestMiddlewareFlow(t *testing.T) {
 	w := httptest.NewRecorder()
 	req := httptest.NewRequest("GET", "/", nil)
@@ -147,6 +209,60 @@ func TestMiddlewareCancel(t *testing.T) {
 	}
 }
 
+func TestNotFoundMethodNotAllowed(t *testing.T) {
+	r := New("/")
+	r.Handle(http.MethodGet, "/plan", http.HandlerFunc(dhandler))
+	r.Handle(http.MethodPost, "/plan", http.HandlerFunc(dhandler))
+
+	d := Build(r)
+	d.Wrap(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.Header().Set("X-Dispatcher", "1")
+			next.ServeHTTP(res, req)
+		})
+	})
+
+	// Defaults answer without body
+	res := httptest.NewRecorder()
+	d.ServeHTTP(res, httptest.NewRequest("DELETE", "/plan", nil))
+	if res.Code != http.StatusMethodNotAllowed || res.Body.Len() != 0 {
+		t.Errorf("Unexpected default 405 response: %d %q", res.Code, res.Body.String())
+	}
+	if allow := res.Header().Get("Allow"); allow != "GET, HEAD, OPTIONS, POST" {
+		t.Errorf("Unexpected Allow header: %s", allow)
+	}
+
+	d.NotFound(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusNotFound)
+		res.Write([]byte("missing"))
+	}))
+	d.MethodNotAllowed(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		res.Write([]byte("not allowed"))
+	}))
+
+	for _, tc := range []struct {
+		method, path string
+		status       int
+		body         string
+	}{
+		{"GET", "/plan", http.StatusOK, "Hello test!"},
+		{"HEAD", "/plan", http.StatusOK, "Hello test!"},
+		{"PUT", "/plan", http.StatusMethodNotAllowed, "not allowed"},
+		{"GET", "/other", http.StatusNotFound, "missing"},
+		{"PUT", "/other", http.StatusNotFound, "missing"},
+	} {
+		res := httptest.NewRecorder()
+		d.ServeHTTP(res, httptest.NewRequest(tc.method, tc.path, nil))
+		if res.Code != tc.status || res.Body.String() != tc.body {
+			t.Errorf("%s %s: got %d %q, want %d %q", tc.method, tc.path, res.Code, res.Body.String(), tc.status, tc.body)
+		}
+		if res.Header().Get("X-Dispatcher") != "1" {
+			t.Errorf("%s %s: dispatcher middleware should run", tc.method, tc.path)
+		}
+	}
+}
+
 func TestConcurrentDispatch(t *testing.T) {
 	r := New("/test")
 	r.Add("/one/:param", http.HandlerFunc(dhandler))
@@ -0,0 +1,73 @@
+package router
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+// ErrBodyTooLarge is returned reading a request body beyond the limit set by BodyLimit.
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// BodyLimit returns a Middleware limiting request bodies to max bytes. Requests
+// announcing a larger Content-Length are answered by tooLarge, a bare 413 if nil,
+// reading more than max bytes of other ones returns ErrBodyTooLarge.
+//
+// Nested limits all apply, so the smallest one wins: a route or group of a limited
+// router can lower the limit but can't raise it. A route needing a larger limit is
+// registered outside the limited router or group, with its own BodyLimit.
+func BodyLimit(max int64, tooLarge http.Handler) Middleware {
+	if tooLarge == nil {
+		tooLarge = statusHandler(http.StatusRequestEntityTooLarge)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > max {
+				w.Header().Set("Connection", "close")
+				tooLarge.ServeHTTP(w, r)
+				return
+			}
+
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = &limitedBody{ReadCloser: r.Body, w: w, remain: max}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// limitedBody reads up to remain bytes of a request body. Going beyond closes the
+// connection once answered, the rest of the body isn't worth reading.
+type limitedBody struct {
+	io.ReadCloser
+	w      http.ResponseWriter
+	remain int64
+	err    error
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	// Read one byte more to tell a body of exactly the limit from a longer one
+	if int64(len(p)) > b.remain+1 {
+		p = p[:b.remain+1]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) <= b.remain {
+		b.remain -= int64(n)
+		b.err = err
+		return n, err
+	}
+
+	n = int(b.remain)
+	b.remain = 0
+	b.err = ErrBodyTooLarge
+	b.w.Header().Set("Connection", "close")
+
+	return n, b.err
+}
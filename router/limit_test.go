@@ -0,0 +1,70 @@
+package router
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyLimit(t *testing.T) {
+	var readErr error
+	read := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var b []byte
+		b, readErr = io.ReadAll(r.Body)
+		if readErr != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		_, _ = w.Write(b)
+	})
+
+	r := New("/")
+	r.Wrap(BodyLimit(8, nil))
+	r.Handle(http.MethodPost, "/small", read)
+	r.Handle(http.MethodPost, "/smaller", read).Wrap(BodyLimit(4, nil))
+	r.Handle(http.MethodPost, "/larger", read).Wrap(BodyLimit(16, nil))
+	d := Build(r)
+
+	for _, tc := range []struct {
+		target, body string
+		chunked      bool
+		status       int
+		err          error
+	}{
+		{target: "/small", body: "12345678", status: 200},
+		{target: "/small", body: "123456789", status: 413},
+		{target: "/small", body: "123456789", chunked: true, status: 413, err: ErrBodyTooLarge},
+		{target: "/small", body: "12345678", chunked: true, status: 200},
+		{target: "/smaller", body: "12345", chunked: true, status: 413, err: ErrBodyTooLarge},
+		{target: "/smaller", body: "1234", status: 200},
+		// The router limit still applies
+		{target: "/larger", body: "123456789", status: 413},
+		{target: "/larger", body: "123456789", chunked: true, status: 413, err: ErrBodyTooLarge},
+		{target: "/small", status: 200},
+	} {
+		readErr = nil
+		req := httptest.NewRequest(http.MethodPost, tc.target, strings.NewReader(tc.body))
+		if tc.chunked {
+			// Unknown length, only reading tells the body is too large
+			req.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, req)
+
+		if w.Code != tc.status {
+			t.Errorf("%s %q: status %d, want %d", tc.target, tc.body, w.Code, tc.status)
+		}
+		if !errors.Is(readErr, tc.err) {
+			t.Errorf("%s %q: read error %v, want %v", tc.target, tc.body, readErr, tc.err)
+		}
+		if tc.status == 200 && w.Body.String() != tc.body {
+			t.Errorf("%s %q: body %q", tc.target, tc.body, w.Body.String())
+		}
+		if got := w.Header().Get("Connection"); tc.status == 413 && got != "close" {
+			t.Errorf("%s %q: Connection %q", tc.target, tc.body, got)
+		}
+	}
+}
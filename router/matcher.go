@@ -0,0 +1,172 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// matcher checks a request condition of a router, adding the captured values to
+// params, allocated on first use, and returning them.
+type matcher func(req *http.Request, params map[string]string) (map[string]string, bool)
+
+// matches reports if the request meets the conditions of r and its parents up to,
+// but excluding, stop, and returns params with the captured values. A nil stop
+// checks every parent.
+func (r *router) matches(req *http.Request, stop *router, params map[string]string) (map[string]string, bool) {
+	ok := true
+	for s := r; s != stop && s != nil; s = s.parent {
+		for _, m := range s.matchers {
+			if params, ok = m(req, params); !ok {
+				return nil, false
+			}
+		}
+	}
+
+	return params, true
+}
+
+func (r *router) Host(pattern string) {
+	p := compileValuePattern(pattern, `[^.]+`, true)
+	port := strings.Contains(pattern, ":")
+
+	r.matchers = append(r.matchers, func(req *http.Request, params map[string]string) (map[string]string, bool) {
+		host := req.Host
+		if !port {
+			host = stripPort(host)
+		}
+
+		return p.match(host, params)
+	})
+}
+
+func (r *router) Header(key, pattern string) {
+	p := compileValuePattern(pattern, `.+`, false)
+
+	r.matchers = append(r.matchers, func(req *http.Request, params map[string]string) (map[string]string, bool) {
+		values := req.Header[http.CanonicalHeaderKey(key)]
+		if len(values) == 0 {
+			return params, false
+		}
+
+		return p.match(values[0], params)
+	})
+}
+
+func (r *router) Query(key, pattern string) {
+	p := compileValuePattern(pattern, `.+`, false)
+
+	r.matchers = append(r.matchers, func(req *http.Request, params map[string]string) (map[string]string, bool) {
+		values := req.URL.Query()[key]
+		if len(values) == 0 {
+			return params, false
+		}
+
+		return p.match(values[0], params)
+	})
+}
+
+func (r *router) Schemes(schemes ...string) {
+	r.matchers = append(r.matchers, func(req *http.Request, params map[string]string) (map[string]string, bool) {
+		scheme := requestScheme(req)
+		for _, s := range schemes {
+			if strings.EqualFold(s, scheme) {
+				return params, true
+			}
+		}
+
+		return params, false
+	})
+}
+
+// requestScheme returns the scheme of an absolute request URL, or tells it from the connection.
+func requestScheme(req *http.Request) string {
+	if req.URL.Scheme != "" {
+		return req.URL.Scheme
+	}
+	if req.TLS != nil {
+		return "https"
+	}
+
+	return "http"
+}
+
+// stripPort removes the port from a host, keeping IPv6 brackets.
+func stripPort(host string) string {
+	i := strings.LastIndexByte(host, ':')
+	if i < 0 || strings.IndexByte(host[i:], ']') >= 0 {
+		return host
+	}
+
+	return host[:i]
+}
+
+// valuePattern matches a value against a pattern with "{name}" captures.
+// A pattern without captures is compared as is, "" matches any value.
+type valuePattern struct {
+	pattern string
+	fold    bool
+	re      *regexp.Regexp
+	names   []string
+}
+
+// compileValuePattern builds a valuePattern where each capture matches the
+// regular expression class. It panics on an unclosed capture, like an invalid
+// constraint, it's a programming error found at registration.
+func compileValuePattern(pattern, class string, fold bool) *valuePattern {
+	p := &valuePattern{pattern: pattern, fold: fold}
+	if !strings.Contains(pattern, "{") {
+		return p
+	}
+
+	var expr strings.Builder
+	if fold {
+		expr.WriteString("(?i)")
+	}
+	expr.WriteByte('^')
+
+	for rest := pattern; rest != ""; {
+		i := strings.IndexByte(rest, '{')
+		if i < 0 {
+			expr.WriteString(regexp.QuoteMeta(rest))
+			break
+		}
+
+		j := strings.IndexByte(rest[i:], '}')
+		if j < 0 {
+			panic(fmt.Sprintf("router: unclosed capture in pattern %q", pattern))
+		}
+
+		expr.WriteString(regexp.QuoteMeta(rest[:i]))
+		expr.WriteString("(" + class + ")")
+		p.names = append(p.names, rest[i+1:i+j])
+		rest = rest[i+j+1:]
+	}
+	expr.WriteByte('$')
+
+	p.re = regexp.MustCompile(expr.String())
+
+	return p
+}
+
+// match reports if v matches, adding the captured values to params.
+func (p *valuePattern) match(v string, params map[string]string) (map[string]string, bool) {
+	if p.re == nil {
+		if p.fold {
+			return params, p.pattern == "" || strings.EqualFold(p.pattern, v)
+		}
+		return params, p.pattern == "" || p.pattern == v
+	}
+
+	m := p.re.FindStringSubmatch(v)
+	if m == nil {
+		return params, false
+	}
+
+	for i, name := range p.names {
+		setParam(&params, name, m[i+1])
+	}
+
+	return params, true
+}
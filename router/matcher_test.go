@@ -0,0 +1,123 @@
+package router
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHostRouting(t *testing.T) {
+	admin := New("/")
+	admin.Host("admin.example.local")
+	admin.Add("/status", http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("admin"))
+	}))
+
+	tenants := New("/")
+	tenants.Host("{tenant}.example.com")
+	tenants.Add("/plan/:id", http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte(Param(req, "tenant") + " " + Param(req, "id")))
+	}))
+
+	public := New("/")
+	public.Add("/status", http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("public"))
+	}))
+
+	d := Build(admin, tenants, public)
+	for _, tc := range []struct {
+		host, target string
+		status       int
+		body         string
+	}{
+		{"admin.example.local", "/status", http.StatusOK, "admin"},
+		{"ADMIN.example.local:8080", "/status", http.StatusOK, "admin"},
+		{"www.example.local", "/status", http.StatusOK, "public"},
+		{"acme.example.com", "/plan/7", http.StatusOK, "acme 7"},
+		{"a.b.example.com", "/plan/7", http.StatusNotFound, ""},
+		{"example.com", "/plan/7", http.StatusNotFound, ""},
+	} {
+		req := httptest.NewRequest("GET", tc.target, nil)
+		req.Host = tc.host
+		res := httptest.NewRecorder()
+		d.ServeHTTP(res, req)
+		if res.Code != tc.status || res.Body.String() != tc.body {
+			t.Errorf("%s%s: got %d %q, want %d %q", tc.host, tc.target, res.Code, res.Body.String(), tc.status, tc.body)
+		}
+	}
+}
+
+func TestHeaderQuerySchemeRouting(t *testing.T) {
+	r := New("/")
+	r.Group("/api", func(g Router) {
+		g.Header("X-Api-Version", "v{version}")
+		g.Add("/plan", http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.Write([]byte("header " + Param(req, "version")))
+		}))
+	})
+	r.Group("/search", func(g Router) {
+		g.Query("format", "")
+		g.Handle(http.MethodGet, "/", http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.Write([]byte("query " + req.URL.Query().Get("format")))
+		}))
+	})
+	r.Group("/secure", func(g Router) {
+		g.Schemes("https")
+		g.Add("/", http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.Write([]byte("secure"))
+		}))
+	})
+
+	d := Build(r)
+	for _, tc := range []struct {
+		target string
+		header string
+		tls    bool
+		status int
+		body   string
+	}{
+		{"/api/plan", "v2", false, http.StatusOK, "header 2"},
+		{"/api/plan", "2", false, http.StatusNotFound, ""},
+		{"/api/plan", "", false, http.StatusNotFound, ""},
+		{"/search?format=csv", "", false, http.StatusOK, "query csv"},
+		{"/search", "", false, http.StatusNotFound, ""},
+		{"/secure", "", true, http.StatusOK, "secure"},
+		{"https://example.com/secure", "", false, http.StatusOK, "secure"},
+		{"/secure", "", false, http.StatusNotFound, ""},
+	} {
+		req := httptest.NewRequest("GET", tc.target, nil)
+		if tc.header != "" {
+			req.Header.Set("X-Api-Version", tc.header)
+		}
+		if tc.tls {
+			req.TLS = &tls.ConnectionState{}
+		}
+		res := httptest.NewRecorder()
+		d.ServeHTTP(res, req)
+		if res.Code != tc.status || res.Body.String() != tc.body {
+			t.Errorf("%s %q: got %d %q, want %d %q", tc.target, tc.header, res.Code, res.Body.String(), tc.status, tc.body)
+		}
+	}
+
+	// Only routes meeting their conditions count for 405
+	res := httptest.NewRecorder()
+	d.ServeHTTP(res, httptest.NewRequest("POST", "/search?format=csv", nil))
+	if res.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", res.Code)
+	}
+	res = httptest.NewRecorder()
+	d.ServeHTTP(res, httptest.NewRequest("POST", "/search", nil))
+	if res.Code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", res.Code)
+	}
+}
+
+func TestInvalidHostPattern(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("An unclosed capture should panic")
+		}
+	}()
+	New("/").Host("{tenant.example.com")
+}
@@ -0,0 +1,72 @@
+package router
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Mount registers h for prefix and every path below it. h receives the request
+// with the prefix removed from URL.Path and URL.RawPath, e.g. "/debug/pprof/heap"
+// becomes "/pprof/heap" for a handler mounted on "/debug". The router middleware
+// wraps mounted handlers like any other route.
+func (r *router) Mount(prefix string, h http.Handler) {
+	full := path.Join("/", r.prefix, prefix)
+	r.Add(path.Join(prefix, "*"), stripSegments(segments(full), h))
+}
+
+// Mount registers h under prefix as a new router at the end of the queue.
+// Dispatcher middleware wraps mounted handlers like any matched route.
+func (d *dispatcher) Mount(prefix string, h http.Handler) {
+	r := New(prefix)
+	r.Mount("/", h)
+	d.Add(r)
+}
+
+// segments counts the parts of a clean path, "/" has none.
+func segments(p string) int {
+	if p == "/" {
+		return 0
+	}
+
+	return strings.Count(p, "/")
+}
+
+// stripSegments removes the first n parts of the request path before calling h.
+// Parameters in the mount prefix are part of those n segments, which is why it
+// doesn't compare strings like http.StripPrefix does.
+func stripSegments(n int, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		u := new(url.URL)
+		*u = *req.URL
+		u.Path = stripPath(req.URL.Path, n)
+		if req.URL.RawPath != "" {
+			u.RawPath = stripPath(req.URL.RawPath, n)
+		}
+
+		r2 := new(http.Request)
+		*r2 = *req
+		r2.URL = u
+		h.ServeHTTP(w, r2)
+	})
+}
+
+// stripPath removes the first n parts of the cleaned p. A trailing slash is kept
+// as handlers such as http.FileServer tell directories by it.
+func stripPath(p string, n int) string {
+	clean := path.Clean("/" + p)
+	for ; n > 0 && clean != "/"; n-- {
+		if i := strings.IndexByte(clean[1:], '/'); i >= 0 {
+			clean = clean[i+1:]
+		} else {
+			clean = "/"
+		}
+	}
+
+	if clean != "/" && strings.HasSuffix(p, "/") {
+		clean += "/"
+	}
+
+	return clean
+}
@@ -0,0 +1,103 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// echoPath writes the path the mounted handler receives.
+func echoPath(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(r.URL.Path + " " + r.URL.RawPath))
+}
+
+func TestRouterMount(t *testing.T) {
+	r := New("/v1")
+	r.Mount("/debug", http.HandlerFunc(echoPath))
+	r.Mount("/tenant/:id/files", http.HandlerFunc(echoPath))
+	d := Build(r)
+
+	tests := map[string]string{
+		"/v1/debug":               "/ ",
+		"/v1/debug/":              "/ ",
+		"/v1/debug/pprof/heap":    "/pprof/heap ",
+		"/v1/debug/pprof/":        "/pprof/ ",
+		"/v1/debug//pprof/../x":   "/x ",
+		"/v1/tenant/7/files/a/b":  "/a/b ",
+		"/v1/debug/a%2Fb/c":       "/a/b/c /a%2Fb/c",
+		"/v1/tenant/7/files/a%20": "/a  ",
+	}
+
+	for url, want := range tests {
+		res := httptest.NewRecorder()
+		d.ServeHTTP(res, httptest.NewRequest("GET", url, nil))
+		if res.Body.String() != want {
+			t.Errorf("%s: mounted handler should receive %q. Got %q", url, want, res.Body.String())
+		}
+	}
+
+	res := httptest.NewRecorder()
+	d.ServeHTTP(res, httptest.NewRequest("GET", "/v1/other", nil))
+	if res.Code != http.StatusNotFound {
+		t.Errorf("/v1/other should not be matched by mounts. Got %d", res.Code)
+	}
+}
+
+func TestDispatcherMount(t *testing.T) {
+	api := New("/api")
+	api.Add("/hello/:name", http.HandlerFunc(helloName))
+	sub := Build(api)
+
+	d := Build()
+	d.Mount("/sub", sub)
+	d.Mount("/echo", http.HandlerFunc(echoPath))
+	d.Wrap(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.Header().Set("X-Dispatcher", "yes")
+			next.ServeHTTP(res, req)
+		})
+	})
+
+	res := httptest.NewRecorder()
+	d.ServeHTTP(res, httptest.NewRequest("GET", "/sub/api/hello/joe", nil))
+	if res.Body.String() != "Hello joe" {
+		t.Errorf("sub-dispatcher response isn't as expected: %s", res.Body.String())
+	}
+	if res.Header().Get("X-Dispatcher") != "yes" {
+		t.Error("dispatcher middleware should wrap mounted handlers")
+	}
+
+	res = httptest.NewRecorder()
+	d.ServeHTTP(res, httptest.NewRequest("GET", "/echo/x", nil))
+	if res.Body.String() != "/x " {
+		t.Errorf("mounted handler response isn't as expected: %s", res.Body.String())
+	}
+}
+
+func TestMountFileServer(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "css"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "css", "site.css"), []byte("body{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	d := Build()
+	d.Mount("/static", http.FileServer(http.Dir(dir)))
+
+	res := httptest.NewRecorder()
+	d.ServeHTTP(res, httptest.NewRequest("GET", "/static/css/site.css", nil))
+	if res.Code != http.StatusOK || res.Body.String() != "body{}" {
+		t.Errorf("file should be served. Got %d %q", res.Code, res.Body.String())
+	}
+
+	// Directory listings keep their trailing slash and don't redirect in a loop
+	res = httptest.NewRecorder()
+	d.ServeHTTP(res, httptest.NewRequest("GET", "/static/css/", nil))
+	if res.Code != http.StatusOK {
+		t.Errorf("directory listing should be served. Got %d", res.Code)
+	}
+}
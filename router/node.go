@@ -1,67 +1,202 @@
 package router
 
 import (
-	"context"
 	"net/http"
-	"path/filepath"
+	"path"
+	"sort"
 	"strings"
 )
 
+// nodeKind tells how a node matches a path part.
+type nodeKind uint8
+
+const (
+	// staticNode matches a path part equal to its path
+	staticNode nodeKind = iota
+
+	// paramNode matches any path part accepted by its constraint, e.g. ":id" or ":id<int>"
+	paramNode
+
+	// catchAllNode matches everything from its position on, "*" or "*name".
+	// A named catch-all captures the rest of the path as a parameter.
+	catchAllNode
+)
+
 // node represents each path part in a route and constructs a tree
 type node struct {
 	path     string
-	handler  http.Handler
+	kind     nodeKind
+	routes   []*route
 	parent   *node
 	children []*node
+
+	// Parameter name and optional constraint of a paramNode
+	name       string
+	constraint constraint
+
+	// Registered with a trailing slash, e.g. "/files/", and without one, e.g. "/files"
+	slash, bare bool
+}
+
+// newNode parses a route part into a node.
+func newNode(part string, parent *node) *node {
+	n := &node{
+		path:     part,
+		children: make([]*node, 0),
+		parent:   parent,
+	}
+
+	switch {
+	case part[0] == '*':
+		n.kind = catchAllNode
+		n.name = part[1:]
+	case len(part) > 1 && part[0] == ':':
+		n.kind = paramNode
+		n.name, n.constraint = parseParam(part[1:])
+	}
+
+	return n
+}
+
+// accepts reports if a paramNode matches the path part.
+func (n *node) accepts(part string) bool {
+	return n.constraint == nil || n.constraint(part)
+}
+
+// setRoute stores rt for its method, replacing a route registered before for the same method.
+func (n *node) setRoute(rt *route) {
+	if rt == nil {
+		return
+	}
+	rt.node = n
+
+	for i, r := range n.routes {
+		if r.method == rt.method {
+			n.routes[i] = rt
+			return
+		}
+	}
+
+	n.routes = append(n.routes, rt)
+}
+
+// routeFor returns the route for method. Routes registered for any method match
+// every request, HEAD requests fall back to GET routes.
+func (n *node) routeFor(method string) *route {
+	var anyMethod, get *route
+	for _, rt := range n.routes {
+		switch rt.method {
+		case method:
+			return rt
+		case "":
+			anyMethod = rt
+		case http.MethodGet:
+			get = rt
+		}
+	}
+
+	if anyMethod != nil {
+		return anyMethod
+	}
+	if method == http.MethodHead {
+		return get
+	}
+
+	return nil
+}
+
+// serves reports if n has a route for method, or any route when method is empty.
+func (n *node) serves(method string) bool {
+	if method == "" {
+		return len(n.routes) > 0
+	}
+
+	return n.routeFor(method) != nil
+}
+
+// acceptsSlash reports if n was registered with the trailing slash of a request path.
+// Nodes not registered by a router, as in tests, count as registered without one.
+func (n *node) acceptsSlash(slash bool) bool {
+	if slash {
+		return n.slash
+	}
+
+	return n.bare || !n.slash
+}
+
+// methods returns the sorted methods of the node routes kept by keep, HEAD included
+// for GET routes and OPTIONS, answered automatically, for any route.
+func (n *node) methods(keep func(*route) bool) []string {
+	methods := make([]string, 0, len(n.routes)+2)
+	options := false
+	for _, rt := range n.routes {
+		if rt.method == "" || !keep(rt) {
+			continue
+		}
+
+		methods = append(methods, rt.method)
+		if rt.method == http.MethodGet && n.routeFor(http.MethodHead) == rt {
+			methods = append(methods, http.MethodHead)
+		}
+		options = options || rt.method == http.MethodOptions
+	}
+	if len(methods) > 0 && !options {
+		methods = append(methods, http.MethodOptions)
+	}
+	sort.Strings(methods)
+
+	return methods
 }
 
 // rootNode is a helper function to initialize the root "/" node for any tree.
-func rootNode(route string, handler http.Handler) *node {
+func rootNode(p string, rt *route) *node {
 	n := &node{
 		path:     "/",
 		children: make([]*node, 0),
 	}
 
-	n.add(route, handler)
+	n.add(p, rt)
 
 	return n
 }
 
-// add constructs the children tree for the current node matching the route provided.
-// It sets the http.Handler to the final element.
-func (n *node) add(route string, handler http.Handler) {
-	// Root and matches
-	if route == n.path || n.path == "*" {
-		n.handler = handler
+// add constructs the children tree for the current node matching the path provided.
+// It sets the route to the final element.
+func (n *node) add(p string, rt *route) {
+	// Root and matches, child paths never repeat the node part, e.g. "/a/a"
+	if (n.parent == nil && p == n.path) || n.kind == catchAllNode {
+		n.setRoute(rt)
 		return
 	}
 
 	// Remove starting and trailing "/"
-	for len(route) > 1 && route[0] == '/' {
-		route = route[1:]
+	for len(p) > 1 && p[0] == '/' {
+		p = p[1:]
 	}
-	for len(route) > 1 && route[len(route)-1] == '/' {
-		route = route[:len(route)-1]
+	for len(p) > 1 && p[len(p)-1] == '/' {
+		p = p[:len(p)-1]
 	}
 
 	// Lookup as far as possible
-	nn, remain := n.walk(strings.Split(route, "/"))
+	nn, remain := n.walk(strings.Split(p, "/"))
+
+	// Existing node, e.g. "/a" added after "/a/b"
+	if len(remain) == 0 {
+		nn.setRoute(rt)
+		return
+	}
 
 	// Add pending parts if any and stop adding after catch-all
 	if len(remain) > 0 {
-		if nn.path != "*" {
+		if nn.kind != catchAllNode {
 			// Create child
-			ch := &node{
-				path:     remain[0],
-				children: make([]*node, 0),
-				parent:   nn,
-			}
+			ch := newNode(remain[0], nn)
 
 			// Go deeper
 			if len(remain) > 1 {
-				ch.add(strings.Join(remain[1:], "/"), handler)
+				ch.add(strings.Join(remain[1:], "/"), rt)
 			} else {
-				ch.handler = handler
+				ch.setRoute(rt)
 			}
 
 			// Save route
@@ -71,6 +206,37 @@ func (n *node) add(route string, handler http.Handler) {
 	}
 }
 
+// pattern returns the route path leading to n, e.g. "/plan/:id<int>".
+func (n *node) pattern() string {
+	if n.parent == nil {
+		return "/"
+	}
+
+	parts := make([]string, 0)
+	for nn := n; nn.parent != nil; nn = nn.parent {
+		parts = append(parts, nn.path)
+	}
+
+	var b strings.Builder
+	for i := len(parts) - 1; i >= 0; i-- {
+		b.WriteByte('/')
+		b.WriteString(parts[i])
+	}
+
+	return b.String()
+}
+
+// each calls fn for every route stored below n, n included.
+func (n *node) each(fn func(*route)) {
+	for _, rt := range n.routes {
+		fn(rt)
+	}
+
+	for _, ch := range n.children {
+		ch.each(fn)
+	}
+}
+
 // walk moves through nodes for a given path until no further match is found.
 func (n *node) walk(parts []string) (*node, []string) {
 	// End at empty
@@ -89,105 +255,178 @@ func (n *node) walk(parts []string) (*node, []string) {
 	return n, parts
 }
 
-// match searches for a matching route to the current request.
-// If found, it adds the route params to the request context and return the corresponding handler.
-func (n *node) match(r *http.Request) http.Handler {
+// match searches for a matching route to the current request path and method, with the default path policy.
+// If found, it adds the route params to the request context and return the corresponding route.
+func (n *node) match(r *http.Request) *route {
+	nn, params, _ := n.lookup(r, PathPolicy{})
+	if nn == nil {
+		return nil
+	}
+
+	rt := nn.routeFor(r.Method)
+	if rt != nil {
+		addParams(r, params, nil)
+	}
+
+	return rt
+}
+
+// lookup searches for the node matching the current request path. A node with a
+// route for the request method wins, e.g. "/plan/:id" for "DELETE /plan/new" when
+// "/plan/new" only has a GET route. Otherwise the node matching the path whatever
+// the method is returned, so the caller can answer 405 or OPTIONS.
+//
+// It returns the node with the route params, left for the caller to add to the
+// request once the route is confirmed, and the escaped path to redirect to when
+// the policy asks for a redirect.
+//
+// The escaped path is matched when it differs from the decoded one, so an encoded
+// slash ("%2F") stays within its segment. Parameter values are unescaped after matching.
+func (n *node) lookup(r *http.Request, policy PathPolicy) (*node, map[string]string, string) {
 	// Validate root node match
 	if n.path != "/" {
-		return nil
+		return nil, nil, ""
 	}
 
-	if r.URL.Path == "/" || r.URL.Path == "" {
-		return n.handler
+	p, escaped := r.URL.Path, false
+	if r.URL.RawPath != "" {
+		p = r.URL.EscapedPath()
+		escaped = p != r.URL.Path
+	}
+	if p == "" {
+		p = "/"
 	}
 
-	// Create parameters storage
-	params := make(map[string]string)
+	// Cleanup path, the request keeps the original one
+	clean := path.Clean(p)
+	slash := clean != "/" && p[len(p)-1] == '/'
 
-	// Cleanup path
-	r.URL.Path = filepath.Clean(r.URL.Path)
+	// Parameters storage, only allocated by routes with parameters
+	var params map[string]string
 
-	// Get handler
-	h := n.matchChild(r.URL.Path[1:], r, params)
+	// Get handler, for the request method first
+	h := n.find(clean, r.Method, escaped, &params)
+	if h == nil {
+		params = nil
+		h = n.find(clean, "", escaped, &params)
+	}
+	if h == nil {
+		return nil, nil, ""
+	}
 
-	// Set params if needed
-	if h != nil && len(params) > 0 {
-		*r = *r.WithContext(context.WithValue(
-			r.Context(),
-			routeParamsKey{},
-			params))
+	// Trailing slash policy, catch-all routes take any path
+	wantSlash := slash
+	if h != n && h.kind != catchAllNode && !h.acceptsSlash(slash) {
+		switch policy.TrailingSlash {
+		case StrictSlash:
+			return nil, nil, ""
+		case RedirectSlash:
+			wantSlash = !slash
+		}
+	}
+
+	if wantSlash != slash || policy.RedirectCleanPath && !isClean(p, clean, slash) {
+		if wantSlash {
+			return h, params, clean + "/"
+		}
+		return h, params, clean
 	}
 
-	return h
+	return h, params, ""
+}
+
+// find returns the node of the clean path serving method, see serves.
+func (n *node) find(clean, method string, escaped bool, params *map[string]string) *node {
+	if clean == "/" && n.serves(method) {
+		return n
+	}
+
+	return n.matchChild(clean[1:], method, escaped, params)
 }
 
 // matchChild does the recursive work of matching the tree parts and try to find the correct path for a route.
-func (n *node) matchChild(part string, r *http.Request, params map[string]string) http.Handler {
-	// Invalid route parts
+// Static children are tried first, then parameters and finally catch-all, backtracking
+// when a branch doesn't lead to a route.
+//
+// A catch-all matches the rest of the path, without its leading slash, even when
+// it's empty: "/files/*path" matches "/files" and "/files/" with path set to "",
+// unless a route is registered for "/files" itself. As the path is cleaned before
+// matching, the captured rest never has a trailing slash.
+func (n *node) matchChild(part, method string, escaped bool, params *map[string]string) *node {
+	// Nothing left, only a catch-all can match
 	if part == "" {
-		return nil
+		return n.matchCatchAll(part, method, escaped, params)
 	}
 
-	// Remove trailing slashes
-	for len(part) > 0 && part[len(part)-1] == '/' {
-		n.matchChild(part[:len(part)-1], r, params)
+	// Split the first part
+	seg, rest, last := part, "", true
+	if i := strings.IndexByte(part, '/'); i >= 0 {
+		seg, rest, last = part[:i], part[i+1:], false
+	}
+	if escaped {
+		seg = unescape(seg)
 	}
 
-	// Split parts
-	for i := range part {
-		if part[i] != '/' && len(part) != (i+1) {
+	// Static parts
+	for _, ch := range n.children {
+		if ch.kind != staticNode || ch.path != seg {
 			continue
 		}
 
-		// Look for matches
-		for _, ch := range n.children {
-			// It's a parameter?
-			if ch.path[0] == ':' {
-				// Are we done?
-				if len(part) == (i + 1) {
-					// Set last param and return
-					params[ch.path[1:]] = part[:i+1]
-					return ch.handler
-				}
+		if last && ch.serves(method) {
+			return ch
+		}
 
-				// Set param
-				params[ch.path[1:]] = part[:i]
+		if h := ch.matchChild(rest, method, escaped, params); h != nil {
+			return h
+		}
+	}
 
-				// Go deeper
-				h := ch.matchChild(part[i+1:], r, params)
-				if h != nil {
-					return h
-				}
-			}
+	// Parameters
+	for _, ch := range n.children {
+		if ch.kind != paramNode || !ch.accepts(seg) {
+			continue
+		}
 
-			// Last route part
-			if len(part) == (i + 1) {
-				if part[:i+1] == ch.path {
-					return ch.handler
-				}
-			}
+		var h *node
+		if last && ch.serves(method) {
+			h = ch
+		} else {
+			h = ch.matchChild(rest, method, escaped, params)
+		}
 
-			// Match current
-			if part[:i] == ch.path {
-				// Go deeper
-				h := ch.matchChild(part[i+1:], r, params)
-				if h != nil {
-					return h
-				}
-			}
+		if h != nil {
+			setParam(params, ch.name, seg)
+			return h
 		}
+	}
 
-		// Check for catch-all routes.
-		for _, ch := range n.children {
-			if ch.path == "*" {
-				return ch.handler
+	return n.matchCatchAll(part, method, escaped, params)
+}
+
+// matchCatchAll returns the catch-all child, capturing part into its param.
+func (n *node) matchCatchAll(part, method string, escaped bool, params *map[string]string) *node {
+	for _, ch := range n.children {
+		if ch.kind == catchAllNode && ch.serves(method) {
+			if ch.name != "" {
+				if escaped {
+					part = unescape(part)
+				}
+				setParam(params, ch.name, part)
 			}
+			return ch
 		}
-
-		// No match found so far
-		return nil
 	}
 
 	// No match found
 	return nil
 }
+
+// setParam stores a route parameter, allocating the storage on first use.
+func setParam(params *map[string]string, key, value string) {
+	if *params == nil {
+		*params = make(map[string]string)
+	}
+
+	(*params)[key] = value
+}
@@ -10,12 +10,12 @@ type emptyHandler struct{}
 func (e emptyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {}
 
 func TestAdd(t *testing.T) {
-	root := rootNode("/", emptyHandler{})
+	root := rootNode("/", &route{handler: emptyHandler{}})
 	if root.path != "/" {
 		t.Errorf("root.path should be '/'. Got %s", root.path)
 	}
 
-	root.add("/some/route/with/five/parts", emptyHandler{})
+	root.add("/some/route/with/five/parts", &route{handler: emptyHandler{}})
 	if len(root.children) != 1 {
 		for _, ch := range root.children {
 			t.Errorf("Error data: %s", ch.path)
@@ -23,7 +23,7 @@ func TestAdd(t *testing.T) {
 		t.Fatalf("root.children should have 1 items. Got %d", len(root.children))
 	}
 
-	root.add("/test/action", emptyHandler{})
+	root.add("/test/action", &route{handler: emptyHandler{}})
 	if len(root.children) != 2 {
 		for _, ch := range root.children {
 			t.Errorf("Error data: %s", ch.path)
@@ -31,3 +31,106 @@ func TestAdd(t *testing.T) {
 		t.Fatalf("root.children should have 2 items. Got %d", len(root.children))
 	}
 }
+
+func TestNamedCatchAll(t *testing.T) {
+	root := rootNode("/", nil)
+	files := &route{handler: emptyHandler{}}
+	exact := &route{handler: emptyHandler{}}
+	all := &route{handler: emptyHandler{}}
+	root.add("/files/*filepath", files)
+	root.add("/docs", exact)
+	root.add("/docs/*page", all)
+	root.add("/static/*", all)
+
+	tests := []struct {
+		path  string
+		route *route
+		param string
+		value string
+	}{
+		{"/files/css/site.css", files, "filepath", "css/site.css"},
+		{"/files/index.html", files, "filepath", "index.html"},
+		// Trailing slashes are cleaned before matching
+		{"/files/css/", files, "filepath", "css"},
+		// Empty remainder
+		{"/files/", files, "filepath", ""},
+		{"/files", files, "filepath", ""},
+		// A route for the prefix itself wins over the empty remainder
+		{"/docs", exact, "page", ""},
+		{"/docs/intro", all, "page", "intro"},
+		{"/static", all, "", ""},
+		{"/static/a/b", all, "", ""},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "http://example.com"+tt.path, nil)
+		rt := root.match(req)
+		if rt != tt.route {
+			t.Errorf("%s matched the wrong route", tt.path)
+			continue
+		}
+
+		if tt.param != "" && Param(req, tt.param) != tt.value {
+			t.Errorf("%s: param *%s should be set to %q. Got %q", tt.path, tt.param, tt.value, Param(req, tt.param))
+		}
+	}
+}
+
+func TestCatchAllPriority(t *testing.T) {
+	root := rootNode("/", nil)
+	static := &route{handler: emptyHandler{}}
+	param := &route{handler: emptyHandler{}}
+	all := &route{handler: emptyHandler{}}
+	root.add("/*rest", all)
+	root.add("/:name/edit", param)
+	root.add("/about", static)
+
+	tests := map[string]*route{
+		"/about":         static,
+		"/joe/edit":      param,
+		"/joe":           all,
+		"/joe/edit/more": all,
+		"/":              all,
+	}
+
+	for path, want := range tests {
+		req, _ := http.NewRequest("GET", "http://example.com"+path, nil)
+		if rt := root.match(req); rt != want {
+			t.Errorf("%s matched the wrong route", path)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "http://example.com/joe/edit/more", nil)
+	root.match(req)
+	if Param(req, "rest") != "joe/edit/more" {
+		t.Errorf("Param *rest should be set to 'joe/edit/more'. Got %q", Param(req, "rest"))
+	}
+}
+
+func TestRepeatedPart(t *testing.T) {
+	root := rootNode("/", nil)
+	short := &route{handler: emptyHandler{}}
+	long := &route{handler: emptyHandler{}}
+	root.add("/x/a/a", long)
+	root.add("/x/a", short)
+
+	tests := map[string]*route{
+		"/x/a":   short,
+		"/x/a/a": long,
+	}
+
+	for path, want := range tests {
+		req, _ := http.NewRequest("GET", "http://example.com"+path, nil)
+		if rt := root.match(req); rt != want {
+			t.Errorf("%s matched the wrong route", path)
+		}
+	}
+
+	// "/x/a/a" alone must not register "/x/a"
+	root = rootNode("/", nil)
+	root.add("/x/a/a", long)
+	req, _ := http.NewRequest("GET", "http://example.com/x/a", nil)
+	if rt := root.match(req); rt != nil {
+		t.Error("/x/a should not match /x/a/a")
+	}
+}
@@ -0,0 +1,78 @@
+package router
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// TrailingSlash tells how a trailing slash in the request path is handled.
+type TrailingSlash uint8
+
+const (
+	// LenientSlash ignores trailing slashes, "/a/" matches a route registered
+	// as "/a" and the other way round. It's the default.
+	LenientSlash TrailingSlash = iota
+
+	// StrictSlash only matches the path with the trailing slash of the registered route.
+	StrictSlash
+
+	// RedirectSlash redirects to the path with the trailing slash of the registered route.
+	RedirectSlash
+)
+
+// PathPolicy configures how request paths are matched. The zero value matches the
+// cleaned path ignoring trailing slashes.
+//
+// Catch-all routes, such as mounted handlers, accept any trailing slash. A path
+// registered both with and without a trailing slash, e.g. "/a" and "/a/", accepts
+// both, the routes of the two being the same tree node.
+type PathPolicy struct {
+	// RedirectCleanPath redirects requests for unclean paths, e.g. "/a//b/../c",
+	// to the clean path instead of serving them.
+	RedirectCleanPath bool
+
+	// TrailingSlash sets the trailing slash handling.
+	TrailingSlash TrailingSlash
+}
+
+// isClean reports if p, with or without its trailing slash, is the clean path.
+func isClean(p, clean string, slash bool) bool {
+	if slash {
+		p = p[:len(p)-1]
+	}
+
+	return p == clean
+}
+
+// unescape decodes an escaped path part, keeping it as is if invalid.
+func unescape(s string) string {
+	if strings.IndexByte(s, '%') < 0 {
+		return s
+	}
+
+	v, err := url.PathUnescape(s)
+	if err != nil {
+		return s
+	}
+
+	return v
+}
+
+// redirectHandler redirects to the escaped path target, keeping the query.
+// Methods other than GET and HEAD get a 308 so they're repeated as is.
+func redirectHandler(target string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		code := http.StatusMovedPermanently
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			code = http.StatusPermanentRedirect
+		}
+
+		u := target
+		if req.URL.RawQuery != "" {
+			u += "?" + req.URL.RawQuery
+		}
+
+		http.Redirect(w, req, u, code)
+	})
+}
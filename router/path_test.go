@@ -0,0 +1,98 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEscapedPath(t *testing.T) {
+	r := New("/")
+	r.Add("/plan/:slug", http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("plan " + Param(req, "slug")))
+	}))
+	r.Add("/plan/:slug/tasks", http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("tasks " + Param(req, "slug")))
+	}))
+	r.Add("/files/*path", http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("file " + Param(req, "path")))
+	}))
+	r.Add("/a b", http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("space"))
+	}))
+
+	d := Build(r)
+	for target, want := range map[string]string{
+		"/plan/a%2Fb":            "plan a/b",
+		"/plan/a%2Fb/tasks":      "tasks a/b",
+		"/plan/caf%C3%A9":        "plan café",
+		"/plan/50%25":            "plan 50%",
+		"/files/dir/a%2Fb.txt":   "file dir/a/b.txt",
+		"/a%20b":                 "space",
+		"/plan/a%2Fb/../x%2Fy/.": "plan x/y",
+	} {
+		res := httptest.NewRecorder()
+		d.ServeHTTP(res, httptest.NewRequest("GET", target, nil))
+		if res.Body.String() != want {
+			t.Errorf("%s: got %d %q, want %q", target, res.Code, res.Body.String(), want)
+		}
+	}
+}
+
+func TestTrailingSlashPolicy(t *testing.T) {
+	newDispatcher := func(policy PathPolicy) Dispatcher {
+		r := New("/v1")
+		r.Policy(policy)
+		r.Add("/plan", http.HandlerFunc(dhandler))
+		r.Add("/dir/", http.HandlerFunc(dhandler))
+		r.Route("/group").Add("/", http.HandlerFunc(dhandler))
+		r.Mount("/static", http.HandlerFunc(dhandler))
+		r.Handle(http.MethodGet, "/both", http.HandlerFunc(dhandler))
+		r.Handle(http.MethodPost, "/both/", http.HandlerFunc(dhandler))
+		r.Wrap(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				res.Header().Set("X-Router", "1")
+				next.ServeHTTP(res, req)
+			})
+		})
+		return Build(r)
+	}
+
+	for _, tc := range []struct {
+		policy   PathPolicy
+		method   string
+		target   string
+		status   int
+		location string
+	}{
+		{PathPolicy{}, "GET", "/v1/plan/", http.StatusOK, ""},
+		{PathPolicy{}, "GET", "/v1/dir", http.StatusOK, ""},
+		{PathPolicy{}, "GET", "/v1//plan/../plan", http.StatusOK, ""},
+		{PathPolicy{TrailingSlash: StrictSlash}, "GET", "/v1/plan", http.StatusOK, ""},
+		{PathPolicy{TrailingSlash: StrictSlash}, "GET", "/v1/plan/", http.StatusNotFound, ""},
+		{PathPolicy{TrailingSlash: StrictSlash}, "GET", "/v1/dir", http.StatusNotFound, ""},
+		{PathPolicy{TrailingSlash: StrictSlash}, "GET", "/v1/dir/", http.StatusOK, ""},
+		{PathPolicy{TrailingSlash: StrictSlash}, "GET", "/v1/group", http.StatusOK, ""},
+		{PathPolicy{TrailingSlash: StrictSlash}, "GET", "/v1/static/", http.StatusOK, ""},
+		{PathPolicy{TrailingSlash: StrictSlash}, "GET", "/v1/both", http.StatusOK, ""},
+		{PathPolicy{TrailingSlash: StrictSlash}, "POST", "/v1/both/", http.StatusOK, ""},
+		{PathPolicy{TrailingSlash: RedirectSlash}, "GET", "/v1/both/", http.StatusOK, ""},
+		{PathPolicy{TrailingSlash: RedirectSlash}, "GET", "/v1/plan/?page=2", http.StatusMovedPermanently, "/v1/plan?page=2"},
+		{PathPolicy{TrailingSlash: RedirectSlash}, "POST", "/v1/dir", http.StatusPermanentRedirect, "/v1/dir/"},
+		{PathPolicy{RedirectCleanPath: true}, "GET", "/v1//plan/./", http.StatusMovedPermanently, "/v1/plan/"},
+		{PathPolicy{RedirectCleanPath: true}, "GET", "/v1/plan/", http.StatusOK, ""},
+		{PathPolicy{RedirectCleanPath: true, TrailingSlash: RedirectSlash}, "GET", "/v1/x/../plan/", http.StatusMovedPermanently, "/v1/plan"},
+		{PathPolicy{RedirectCleanPath: true}, "GET", "/v1/plan/a%2Fb/..", http.StatusMovedPermanently, "/v1/plan"},
+	} {
+		res := httptest.NewRecorder()
+		newDispatcher(tc.policy).ServeHTTP(res, httptest.NewRequest(tc.method, tc.target, nil))
+		if res.Code != tc.status || res.Header().Get("Location") != tc.location {
+			t.Errorf("%+v %s %s: got %d %q, want %d %q", tc.policy, tc.method, tc.target,
+				res.Code, res.Header().Get("Location"), tc.status, tc.location)
+		}
+		// Redirects run in the middleware of the route, like the route itself
+		if res.Code != http.StatusNotFound && res.Header().Get("X-Router") != "1" {
+			t.Errorf("%+v %s %s: router middleware should run", tc.policy, tc.method, tc.target)
+		}
+	}
+}
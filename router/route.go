@@ -0,0 +1,57 @@
+package router
+
+import "net/http"
+
+// route is a handler registered in the tree together with the router (or group)
+// that registered it. The handler wrapped in all its middleware is compiled once
+// into chain, so matching a request doesn't allocate.
+type route struct {
+	// Request method, empty for any method
+	method  string
+	handler http.Handler
+	scope   *router
+	chain   http.Handler
+
+	// Tree node holding the route and optional name for URL reversal
+	node *node
+	name string
+
+	// Middleware of this route only, run after the router middleware
+	middleware []Middleware
+}
+
+// compile wraps the handler in the route middleware.
+func (rt *route) compile() {
+	rt.chain = rt.wrap(rt.handler)
+}
+
+// wrap wraps h with the middleware of the route, then of its router and every
+// parent router, the innermost group first, and finally of the dispatcher.
+func (rt *route) wrap(h http.Handler) http.Handler {
+	for _, m := range rt.middleware {
+		h = m(h)
+	}
+
+	for s := rt.scope; s != nil; s = s.parent {
+		for _, m := range s.middleware {
+			h = m(h)
+		}
+	}
+
+	for _, m := range rt.scope.root().dispatcher {
+		h = m(h)
+	}
+
+	return h
+}
+
+// within reports if the route was registered by r or one of its groups.
+func (rt *route) within(r *router) bool {
+	for s := rt.scope; s != nil; s = s.parent {
+		if s == r {
+			return true
+		}
+	}
+
+	return false
+}
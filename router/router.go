@@ -1,8 +1,13 @@
 package router
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"path"
+	"strconv"
+	"strings"
 )
 
 // Middleware type defines the function signature for middleware implementation
@@ -11,16 +16,65 @@ type Middleware func(http.Handler) http.Handler
 // Router implements the needed methods for the Dispatcher
 // to be able to match and execute requests.
 type Router interface {
-	// Add takes a route path and a handler to store for further matching
-	Add(path string, handler http.Handler)
+	// Add takes a route path and a handler to store for further matching, for any request method
+	Add(path string, handler http.Handler) Entry
+
+	// Handle is like Add, for a single request method.
+	// A path with handlers for some methods only answers other methods with 405 Method Not Allowed.
+	Handle(method, path string, handler http.Handler) Entry
 
 	// Wrap takes a Middleware to wrap all handlers in order (from inside out) at router level.
 	Wrap(Middleware)
 
+	// Group creates a sub-router for prefix (relative to this router) and passes it to fn.
+	// Middleware wrapped in the group only applies to the routes added to the group
+	// and to its nested groups, after the middleware of the parent router.
+	Group(prefix string, fn func(Router))
+
+	// Mount registers an http.Handler for prefix and every path below it, removing
+	// the prefix from the request path, e.g. to serve net/http/pprof or an http.FileServer.
+	Mount(prefix string, h http.Handler)
+
+	// Route returns a sub-router for prefix, like Group does.
+	// Routes of every sub-router are stored in the single tree of the root router.
+	Route(prefix string) Router
+
+	// Host restricts the router to requests for a host matching pattern, ignoring the port
+	// unless pattern has one. Each "{name}" in pattern matches a single label, e.g.
+	// "{tenant}.example.com", and is exposed as a route parameter.
+	// As groups share a single tree, serving the same path for several hosts takes
+	// separate routers, tried in order by the Dispatcher.
+	Host(pattern string)
+
+	// Header restricts the router to requests with the header key matching pattern,
+	// "" matching any value. Each "{name}" in pattern is exposed as a route parameter.
+	Header(key, pattern string)
+
+	// Query restricts the router to requests with the query value key matching pattern,
+	// "" matching any value. Each "{name}" in pattern is exposed as a route parameter.
+	Query(key, pattern string)
+
+	// Schemes restricts the router to requests made with one of schemes, e.g. "https".
+	Schemes(schemes ...string)
+
+	// Policy sets how request paths are cleaned and matched, for every router of the tree.
+	Policy(PathPolicy)
+
 	// Match checks if a request matches this router.
 	// If so, adds the route parameters to the request context and returns the corresponding handler.
-	// If route doesn't matches, the response is nil
+	// If route doesn't matches, the response is nil.
+	// A sub-router only matches its own routes and the routes of its groups.
 	Match(*http.Request) http.Handler
+
+	// Allowed returns the methods of the routes matching the request path, nil if none does.
+	Allowed(*http.Request) []string
+
+	// Routes describes the routes of this router and its groups, sorted by pattern and method.
+	Routes() []RouteInfo
+
+	// URL builds the path of the route named name, escaping params.
+	// Names are shared by every router of a tree, so a group can build the URL of any route.
+	URL(name string, params map[string]string) (string, error)
 }
 
 // New creates a new Router with the provided prefix
@@ -43,32 +97,196 @@ type router struct {
 
 	// Middlewares collection
 	middleware []Middleware
+
+	// Parent router of a group, nil for the root router
+	parent *router
+
+	// Path policy of the tree, set on the root router
+	policy PathPolicy
+
+	// Request conditions, such as the host, checked before matching the routes
+	matchers []matcher
+
+	// Middleware of the dispatcher serving the tree, set on the root router
+	dispatcher []Middleware
 }
 
-func (r *router) Add(route string, h http.Handler) {
-	r.tree.add(path.Join(r.prefix, route), h)
+func (r *router) Add(p string, h http.Handler) Entry {
+	return r.Handle("", p, h)
+}
+
+func (r *router) Handle(method, p string, h http.Handler) Entry {
+	rt := &route{method: method, handler: h, scope: r}
+	rt.compile()
+	r.tree.add(path.Join(r.prefix, p), rt)
+
+	// "/" in a group stands for the group path itself
+	if p != "/" && strings.HasSuffix(p, "/") {
+		rt.node.slash = true
+	} else {
+		rt.node.bare = true
+	}
+
+	return rt
 }
 
+// Wrap rebuilds the handler chain of every route affected by the new middleware.
+// Like Add, it's meant to be called before serving requests.
 func (r *router) Wrap(m Middleware) {
 	r.middleware = append(r.middleware, m)
+	r.tree.each(func(rt *route) {
+		if rt.within(r) {
+			rt.compile()
+		}
+	})
+}
+
+// dispatchWith compiles the middleware of the dispatcher serving the tree into
+// the chain of every route, so the dispatcher doesn't wrap handlers per request.
+func (r *router) dispatchWith(middleware []Middleware) {
+	root := r.root()
+	root.dispatcher = middleware
+	root.tree.each(func(rt *route) {
+		rt.compile()
+	})
+}
+
+func (r *router) Group(prefix string, fn func(Router)) {
+	fn(r.Route(prefix))
+}
+
+func (r *router) Route(prefix string) Router {
+	return &router{
+		prefix:     path.Join(r.prefix, prefix),
+		tree:       r.tree,
+		middleware: make([]Middleware, 0),
+		parent:     r,
+	}
+}
+
+func (r *router) Policy(p PathPolicy) {
+	r.root().policy = p
 }
 
 func (r *router) Match(req *http.Request) http.Handler {
-	h := r.tree.match(req)
+	// Conditions of the router and its parents are checked before the path
+	captures, ok := r.matches(req, nil, nil)
+	if !ok {
+		return nil
+	}
+
+	n, params, redirect := r.tree.lookup(req, r.root().policy)
+	if n == nil {
+		return nil
+	}
 
-	if h == nil {
+	rt := n.routeFor(req.Method)
+	if rt == nil && req.Method == http.MethodOptions {
+		return r.options(req, n, params, captures)
+	}
+	if rt == nil || !rt.within(r) {
+		return nil
+	}
+	if captures, ok = rt.scope.matches(req, r, captures); !ok {
 		return nil
 	}
 
-	for _, m := range r.middleware {
-		h = m(h)
+	if redirect != "" {
+		return rt.wrap(redirectHandler(redirect))
 	}
 
-	return h
+	addParams(req, params, captures)
+
+	return rt.chain
+}
+
+func (r *router) Allowed(req *http.Request) []string {
+	captures, ok := r.matches(req, nil, nil)
+	if !ok {
+		return nil
+	}
+
+	n, _, _ := r.tree.lookup(req, r.root().policy)
+	if n == nil {
+		return nil
+	}
+
+	methods := n.methods(r.keep(req, captures))
+	if len(methods) == 0 {
+		return nil
+	}
+
+	return methods
+}
+
+// keep returns a filter of the routes of r meeting their conditions.
+func (r *router) keep(req *http.Request, captures map[string]string) func(*route) bool {
+	return func(rt *route) bool {
+		if !rt.within(r) {
+			return false
+		}
+
+		_, ok := rt.scope.matches(req, r, captures)
+		return ok
+	}
+}
+
+// options answers an OPTIONS request for a path without OPTIONS route. The
+// handler sets the Allow header and runs inside the middleware of the route of
+// the preflight request method, or of the first route of the path, so a CORS
+// middleware can answer preflight requests.
+func (r *router) options(req *http.Request, n *node, params, captures map[string]string) http.Handler {
+	keep := r.keep(req, captures)
+
+	rt := n.routeFor(req.Header.Get("Access-Control-Request-Method"))
+	if rt == nil || !keep(rt) {
+		rt = nil
+		for _, other := range n.routes {
+			if keep(other) {
+				rt = other
+				break
+			}
+		}
+	}
+	if rt == nil {
+		return nil
+	}
+
+	methods := n.methods(keep)
+	addParams(req, params, captures)
+	*req = *req.WithContext(context.WithValue(req.Context(), allowedMethodsKey{}, methods))
+
+	return rt.wrap(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+type allowedMethodsKey struct{}
+
+// AllowedMethods returns the methods registered for the path of an OPTIONS
+// request answered automatically, nil for any other request.
+func AllowedMethods(req *http.Request) []string {
+	methods, _ := req.Context().Value(allowedMethodsKey{}).([]string)
+	return methods
 }
 
 type routeParamsKey struct{}
 
+// addParams sets the route parameters of a matched request, path parameters win
+// over the captures of the router conditions of the same name.
+func addParams(req *http.Request, params, captures map[string]string) {
+	for k, v := range captures {
+		if _, ok := params[k]; !ok {
+			setParam(&params, k, v)
+		}
+	}
+
+	if len(params) > 0 {
+		*req = *req.WithContext(context.WithValue(req.Context(), routeParamsKey{}, params))
+	}
+}
+
 // Params returns a map[string]string containing all route parameters
 func Params(req *http.Request) map[string]string {
 	params := req.Context().Value(routeParamsKey{})
@@ -90,3 +308,21 @@ func Param(req *http.Request, key string) string {
 
 	return ""
 }
+
+// ErrMissingParam is returned by the typed param accessors for an unknown route param.
+var ErrMissingParam = errors.New("missing route param")
+
+// ParamInt returns a route param as an int, e.g. for a ":id<int>" route.
+func ParamInt(req *http.Request, key string) (int, error) {
+	v, ok := Params(req)[key]
+	if !ok {
+		return 0, fmt.Errorf("%w %q", ErrMissingParam, key)
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("route param %q: invalid int %q", key, v)
+	}
+
+	return n, nil
+}
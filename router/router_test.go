@@ -1,7 +1,9 @@
 package router
 
 import (
+	"errors"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -195,3 +197,178 @@ func TestGetWrongParam(t *testing.T) {
 		t.Errorf("Param for :invalid should have been ''. Got %s", Param(req, "invalid"))
 	}
 }
+
+func tagMiddleware(tag string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.Write([]byte(tag + "("))
+			next.ServeHTTP(res, req)
+			res.Write([]byte(")"))
+		})
+	}
+}
+
+func TestGroup(t *testing.T) {
+	r := New("/v1")
+	r.Wrap(tagMiddleware("root"))
+	r.Add("/health", http.HandlerFunc(handler))
+
+	r.Group("/plan", func(r Router) {
+		r.Wrap(tagMiddleware("auth"))
+		r.Add("/", http.HandlerFunc(handler))
+		r.Add("/:id", http.HandlerFunc(handler))
+
+		r.Group("/admin", func(r Router) {
+			r.Wrap(tagMiddleware("admin"))
+			r.Add("/stats", http.HandlerFunc(handler))
+		})
+	})
+
+	tests := map[string]string{
+		"http://example.com/v1/health":           "root(Hello test!)",
+		"http://example.com/v1/plan":             "root(auth(Hello test!))",
+		"http://example.com/v1/plan/1":           "root(auth(Hello test!))",
+		"http://example.com/v1/plan/admin/stats": "root(auth(admin(Hello test!)))",
+	}
+
+	for url, want := range tests {
+		req, _ := http.NewRequest("GET", url, nil)
+		h := r.Match(req)
+		if h == nil {
+			t.Errorf("%s should have matched our routes", url)
+			continue
+		}
+
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		if res.Body.String() != want {
+			t.Errorf("%s: response body should be %q. Got %q", url, want, res.Body.String())
+		}
+	}
+}
+
+func TestSubRouterMatch(t *testing.T) {
+	r := New("/v1")
+	r.Add("/health", http.HandlerFunc(handler))
+	plan := r.Route("/plan")
+	plan.Add("/:id", http.HandlerFunc(handler))
+
+	req, _ := http.NewRequest("GET", "http://example.com/v1/plan/1", nil)
+	if plan.Match(req) == nil {
+		t.Error("sub-router should match its own routes")
+	}
+	if r.Match(req) == nil {
+		t.Error("root router should match routes of its groups")
+	}
+
+	req, _ = http.NewRequest("GET", "http://example.com/v1/health", nil)
+	if plan.Match(req) != nil {
+		t.Error("sub-router shouldn't match routes of its parent")
+	}
+}
+
+func TestAddParentAfterChild(t *testing.T) {
+	r := New("/")
+	r.Add("/a/b", http.HandlerFunc(handler))
+	r.Add("/a", http.HandlerFunc(handler))
+
+	req, _ := http.NewRequest("GET", "http://example.com/a", nil)
+	if r.Match(req) == nil {
+		t.Error("/a should match after being added below /a/b")
+	}
+}
+
+func TestConstrainedParam(t *testing.T) {
+	r := New("/")
+	r.Add("/plan/:id<int>", http.HandlerFunc(handler))
+	r.Add("/plan/:slug<[a-z-]+>", http.HandlerFunc(handler))
+	r.Add("/plan/export", http.HandlerFunc(handler))
+	r.Add("/token/:token<uuid>/show", http.HandlerFunc(handler))
+	r.Add("/token/:name/show", http.HandlerFunc(handler))
+
+	tests := []struct {
+		url   string
+		key   string
+		value string
+	}{
+		{"http://example.com/plan/42", "id", "42"},
+		{"http://example.com/plan/0", "id", "0"},
+		{"http://example.com/plan/my-plan", "slug", "my-plan"},
+		{"http://example.com/plan/export", "slug", ""},
+		{"http://example.com/token/123e4567-e89b-12d3-a456-426614174000/show", "token", "123e4567-e89b-12d3-a456-426614174000"},
+		{"http://example.com/token/joe/show", "name", "joe"},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", tt.url, nil)
+		if r.Match(req) == nil {
+			t.Errorf("%s should have matched our routes", tt.url)
+		} else if Param(req, tt.key) != tt.value {
+			t.Errorf("%s: param :%s should be set to %q. Got %q", tt.url, tt.key, tt.value, Param(req, tt.key))
+		}
+	}
+
+	nomatches := []string{
+		"http://example.com/plan/My_Plan",
+		"http://example.com/plan/12a",
+		"http://example.com/plan/+5",
+		"http://example.com/plan/-0",
+		"http://example.com/plan/-1",
+		"http://example.com/plan/99999999999999999999",
+	}
+
+	for _, nomatch := range nomatches {
+		req, _ := http.NewRequest("GET", nomatch, nil)
+		if r.Match(req) != nil {
+			t.Errorf("%s shouldn't have matched our routes", nomatch)
+		}
+	}
+}
+
+func TestConstraintFallthrough(t *testing.T) {
+	r := New("/")
+	r.Add("/:id<int>/edit", http.HandlerFunc(handler))
+	r.Add("/:name/view", http.HandlerFunc(handler))
+
+	req, _ := http.NewRequest("GET", "http://example.com/12/view", nil)
+	if r.Match(req) == nil {
+		t.Fatal("/12/view should fall through to /:name/view")
+	}
+	if Param(req, "name") != "12" {
+		t.Errorf("Param :name should be set to '12'. Got %s", Param(req, "name"))
+	}
+	if _, ok := Params(req)["id"]; ok {
+		t.Error("Param :id of the failed branch shouldn't be set")
+	}
+}
+
+func TestInvalidConstraint(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Add should panic on an invalid constraint")
+		}
+	}()
+
+	New("/").Add("/:id<[0-9>", http.HandlerFunc(handler))
+}
+
+func TestParamInt(t *testing.T) {
+	r := New("/")
+	r.Add("/plan/:id<int>", http.HandlerFunc(handler))
+	r.Add("/name/:name", http.HandlerFunc(handler))
+
+	req, _ := http.NewRequest("GET", "http://example.com/plan/42", nil)
+	r.Match(req)
+	if id, err := ParamInt(req, "id"); err != nil || id != 42 {
+		t.Errorf("ParamInt should return 42. Got %d, %v", id, err)
+	}
+	if _, err := ParamInt(req, "other"); !errors.Is(err, ErrMissingParam) {
+		t.Errorf("ParamInt should return ErrMissingParam for unknown params. Got %v", err)
+	}
+
+	req, _ = http.NewRequest("GET", "http://example.com/name/joe", nil)
+	r.Match(req)
+	if _, err := ParamInt(req, "name"); err == nil {
+		t.Error("ParamInt should fail on a non int value")
+	}
+}
@@ -0,0 +1,176 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// ErrUnknownRoute is returned by URL for a name no route was given.
+var ErrUnknownRoute = errors.New("unknown route")
+
+// Entry is a route returned by Add and Handle to complete its registration.
+type Entry interface {
+	// Name names the route for URL. It panics if another route of the tree has the name.
+	Name(name string) Entry
+
+	// Wrap takes a Middleware to wrap the route handler, inside the router middleware.
+	// The route middleware also runs for the automatic OPTIONS responses of its path.
+	Wrap(Middleware) Entry
+}
+
+// RouteInfo describes a registered route.
+type RouteInfo struct {
+	// Request method, empty for any method
+	Method string
+
+	// Route path including the router prefix, e.g. "/v1/plan/:id<int>"
+	Pattern string
+
+	// Name given with Entry.Name, if any
+	Name string
+
+	// Names of the router and route middleware wrapping the handler, outermost first
+	Middleware []string
+}
+
+func (rt *route) Name(name string) Entry {
+	rt.scope.root().tree.each(func(other *route) {
+		if other != rt && other.name == name {
+			panic(fmt.Sprintf("router: route name %q already used by %s", name, other.node.pattern()))
+		}
+	})
+	rt.name = name
+
+	return rt
+}
+
+func (rt *route) Wrap(m Middleware) Entry {
+	rt.middleware = append(rt.middleware, m)
+	rt.compile()
+
+	return rt
+}
+
+// info describes the route.
+func (rt *route) info() RouteInfo {
+	// Same order as wrap, innermost first
+	middleware := make([]string, 0)
+	for _, m := range rt.middleware {
+		middleware = append(middleware, funcName(m))
+	}
+	for s := rt.scope; s != nil; s = s.parent {
+		for _, m := range s.middleware {
+			middleware = append(middleware, funcName(m))
+		}
+	}
+	for i, j := 0, len(middleware)-1; i < j; i, j = i+1, j-1 {
+		middleware[i], middleware[j] = middleware[j], middleware[i]
+	}
+
+	return RouteInfo{
+		Method:     rt.method,
+		Pattern:    rt.node.pattern(),
+		Name:       rt.name,
+		Middleware: middleware,
+	}
+}
+
+// funcName returns the name of a function as reported in stack traces.
+func funcName(fn interface{}) string {
+	if f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()); f != nil {
+		return f.Name()
+	}
+
+	return "?"
+}
+
+// root returns the router owning the tree.
+func (r *router) root() *router {
+	for r.parent != nil {
+		r = r.parent
+	}
+
+	return r
+}
+
+func (r *router) Routes() []RouteInfo {
+	routes := make([]RouteInfo, 0)
+	r.tree.each(func(rt *route) {
+		if rt.within(r) {
+			routes = append(routes, rt.info())
+		}
+	})
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Pattern != routes[j].Pattern {
+			return routes[i].Pattern < routes[j].Pattern
+		}
+		return routes[i].Method < routes[j].Method
+	})
+
+	return routes
+}
+
+func (r *router) URL(name string, params map[string]string) (string, error) {
+	var rt *route
+	r.tree.each(func(other *route) {
+		if other.name == name {
+			rt = other
+		}
+	})
+	if rt == nil {
+		return "", fmt.Errorf("%w %q", ErrUnknownRoute, name)
+	}
+
+	// Nodes from the root down to the route
+	nodes := make([]*node, 0)
+	for n := rt.node; n.parent != nil; n = n.parent {
+		nodes = append(nodes, n)
+	}
+
+	var b strings.Builder
+	for i := len(nodes) - 1; i >= 0; i-- {
+		n := nodes[i]
+		switch n.kind {
+		case staticNode:
+			b.WriteByte('/')
+			b.WriteString(n.path)
+		case paramNode:
+			v, ok := params[n.name]
+			if !ok {
+				return "", fmt.Errorf("%w %q", ErrMissingParam, n.name)
+			}
+			if v == "" || !n.accepts(v) {
+				return "", fmt.Errorf("route param %q: invalid value %q", n.name, v)
+			}
+			b.WriteByte('/')
+			b.WriteString(url.PathEscape(v))
+		case catchAllNode:
+			if n.name == "" {
+				continue
+			}
+			v, ok := params[n.name]
+			if !ok {
+				return "", fmt.Errorf("%w %q", ErrMissingParam, n.name)
+			}
+			// The rest of the path keeps its slashes
+			for _, part := range strings.Split(strings.Trim(v, "/"), "/") {
+				if part != "" {
+					b.WriteByte('/')
+					b.WriteString(url.PathEscape(part))
+				}
+			}
+		}
+	}
+
+	if b.Len() == 0 {
+		return "/", nil
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,96 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func nopMiddleware(next http.Handler) http.Handler {
+	return next
+}
+
+func TestRoutes(t *testing.T) {
+	r := New("/v1")
+	r.Wrap(nopMiddleware)
+	r.Handle(http.MethodPost, "/plan", http.HandlerFunc(dhandler)).Name("plan.create")
+	r.Handle(http.MethodGet, "/plan", http.HandlerFunc(dhandler)).Name("plan.list")
+	r.Group("/plan", func(g Router) {
+		g.Wrap(func(next http.Handler) http.Handler { return next })
+		g.Handle(http.MethodGet, "/:id<int>", http.HandlerFunc(dhandler)).Name("plan.get")
+	})
+	r.Add("/x/a/b", http.HandlerFunc(dhandler))
+
+	routes := r.Routes()
+	want := []RouteInfo{
+		{Method: "GET", Pattern: "/v1/plan", Name: "plan.list", Middleware: []string{"github.com/h4ckm03d/simpleplan/router.nopMiddleware"}},
+		{Method: "POST", Pattern: "/v1/plan", Name: "plan.create", Middleware: []string{"github.com/h4ckm03d/simpleplan/router.nopMiddleware"}},
+		{Method: "GET", Pattern: "/v1/plan/:id<int>", Name: "plan.get"},
+		{Pattern: "/v1/x/a/b", Middleware: []string{"github.com/h4ckm03d/simpleplan/router.nopMiddleware"}},
+	}
+	if len(routes) != len(want) {
+		t.Fatalf("Unexpected routes: %+v", routes)
+	}
+	for i := range want {
+		if i == 2 {
+			// Anonymous group middleware runs after the router one
+			if len(routes[i].Middleware) != 2 || routes[i].Middleware[0] != want[0].Middleware[0] {
+				t.Errorf("Unexpected group middleware: %v", routes[i].Middleware)
+			}
+			routes[i].Middleware = nil
+		}
+		if !reflect.DeepEqual(routes[i], want[i]) {
+			t.Errorf("Route %d: got %+v, want %+v", i, routes[i], want[i])
+		}
+	}
+
+	if len(Build(r, New("/v2")).Routes()) != len(want) {
+		t.Error("Dispatcher should list the routes of every router")
+	}
+}
+
+func TestDuplicateName(t *testing.T) {
+	r := New("/")
+	r.Add("/a", http.HandlerFunc(dhandler)).Name("a")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Reusing a route name should panic")
+		}
+	}()
+	r.Route("/g").Add("/b", http.HandlerFunc(dhandler)).Name("a")
+}
+
+func TestURL(t *testing.T) {
+	r := New("/v1")
+	r.Add("/", http.HandlerFunc(dhandler)).Name("root")
+	r.Add("/plan/:id<int>", http.HandlerFunc(dhandler)).Name("plan")
+	r.Add("/users/:name/files/*path", http.HandlerFunc(dhandler)).Name("files")
+	g := r.Route("/static")
+	g.Mount("/", http.HandlerFunc(dhandler))
+
+	for _, tc := range []struct {
+		name   string
+		params map[string]string
+		url    string
+		err    error
+	}{
+		{"root", nil, "/v1", nil},
+		{"plan", map[string]string{"id": "42"}, "/v1/plan/42", nil},
+		{"plan", map[string]string{"id": "abc"}, "", nil},
+		{"plan", nil, "", ErrMissingParam},
+		{"files", map[string]string{"name": "a b/c?", "path": "dir/x y.txt"}, "/v1/users/a%20b%2Fc%3F/files/dir/x%20y.txt", nil},
+		{"files", map[string]string{"name": "joe", "path": ""}, "/v1/users/joe/files", nil},
+		{"missing", nil, "", ErrUnknownRoute},
+	} {
+		// Names are shared by the groups of a tree
+		url, err := g.URL(tc.name, tc.params)
+		if url != tc.url {
+			t.Errorf("URL(%q, %v) = %q, want %q", tc.name, tc.params, url, tc.url)
+		}
+		if tc.url == "" && err == nil || tc.err != nil && !errors.Is(err, tc.err) {
+			t.Errorf("URL(%q, %v): unexpected error %v", tc.name, tc.params, err)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// PanicError is the panic of a handler run in another goroutine, raised again in
+// the goroutine serving the request.
+type PanicError struct {
+	Value interface{}
+
+	// Stack holds the program counters of the goroutine that panicked, from the
+	// function that panicked, as filled by runtime.Callers.
+	Stack []uintptr
+}
+
+// newPanicError wraps p, it must be called by the deferred function recovering.
+func newPanicError(p interface{}) *PanicError {
+	pc := make([]uintptr, 64)
+	// Skip runtime.Callers, newPanicError, the deferred function and runtime.gopanic
+	n := runtime.Callers(4, pc)
+	return &PanicError{Value: p, Stack: pc[:n]}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprint(e.Value)
+}
+
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// Timeout returns a Middleware giving handlers d to answer. The request context
+// is canceled after d, then the response is answered by timedOut, a bare 503 if
+// nil, whatever the handler does later.
+//
+// Handlers run in another goroutine. Their panics are raised again as a *PanicError
+// in the goroutine serving the request, http.ErrAbortHandler as is. Once timedOut
+// answered there's no one left to raise them to, so they're passed to late instead,
+// logged with the standard logger if nil.
+//
+// The response is buffered until the handler returns, so routes streaming their
+// response or hijacking the connection shouldn't have a timeout.
+func Timeout(d time.Duration, timedOut http.Handler, late func(*http.Request, *PanicError)) Middleware {
+	if timedOut == nil {
+		timedOut = statusHandler(http.StatusServiceUnavailable)
+	}
+	if late == nil {
+		late = func(r *http.Request, p *PanicError) {
+			log.Printf("router: %s %s: panic after the timeout: %v", r.Method, r.URL.Path, p)
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{ctx: ctx, header: make(http.Header)}
+			done := make(chan struct{})
+			panicked := make(chan interface{}, 1)
+
+			go func() {
+				defer func() {
+					p := recover()
+					if p == nil {
+						close(done)
+						return
+					}
+					if p != http.ErrAbortHandler {
+						p = newPanicError(p)
+					}
+
+					if !tw.handOver(p, panicked) {
+						if pe, ok := p.(*PanicError); ok {
+							late(r, pe)
+						}
+					}
+				}()
+
+				next.ServeHTTP(tw, r)
+			}()
+
+			select {
+			case p := <-panicked:
+				// Raised again in the server goroutine, for the recovery middleware
+				panic(p)
+			case <-done:
+			case <-ctx.Done():
+				tw.timeout()
+				// Handed over before the timeout, it's still for the recovery middleware
+				select {
+				case p := <-panicked:
+					panic(p)
+				default:
+				}
+			}
+
+			if !tw.flush(w) {
+				timedOut.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// timeoutWriter buffers the response of a handler with a timeout. Writes once
+// the context is done fail with http.ErrHandlerTimeout.
+type timeoutWriter struct {
+	ctx      context.Context
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(status int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.expired() || w.status != 0 {
+		return
+	}
+	w.status = status
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.expired() {
+		return 0, http.ErrHandlerTimeout
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	return w.buf.Write(b)
+}
+
+// expired reports if the time is over, the caller must hold the lock.
+func (w *timeoutWriter) expired() bool {
+	if !w.timedOut && w.ctx.Err() != nil {
+		w.timedOut = true
+	}
+
+	return w.timedOut
+}
+
+// handOver sends the panic p of the handler to panicked, unless the time is over.
+// Both are decided under the lock, so a panic is either raised or late.
+func (w *timeoutWriter) handOver(p interface{}, panicked chan<- interface{}) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.expired() {
+		return false
+	}
+	panicked <- p
+
+	return true
+}
+
+// timeout makes the later writes fail.
+func (w *timeoutWriter) timeout() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.timedOut = true
+}
+
+// flush sends the buffered response to rw, unless the handler didn't answer in time.
+func (w *timeoutWriter) flush(rw http.ResponseWriter) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.expired() {
+		return false
+	}
+
+	h := rw.Header()
+	for k, v := range w.header {
+		h[k] = v
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	rw.WriteHeader(w.status)
+	_, _ = rw.Write(w.buf.Bytes())
+
+	return true
+}
@@ -0,0 +1,114 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	lateWrite := make(chan error, 1)
+
+	r := New("/")
+	r.Wrap(Timeout(20*time.Millisecond, nil, nil))
+	r.Add("/fast", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("X-Plan", "1")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, "created")
+	}))
+	r.Add("/slow", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		w.Header().Set("X-Plan", "1")
+		_, err := io.WriteString(w, "too late")
+		lateWrite <- err
+	}))
+	r.Add("/param/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); !ok {
+			t.Error("no deadline")
+		}
+		_, _ = io.WriteString(w, Param(r, "id"))
+	}))
+	r.Handle(http.MethodGet, "/longer", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Nested timeouts, the earliest deadline applies
+		<-r.Context().Done()
+		if !errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+			t.Errorf("context error %v", r.Context().Err())
+		}
+	})).Wrap(Timeout(time.Hour, nil, nil))
+	d := Build(r)
+
+	for _, tc := range []struct {
+		target string
+		status int
+		body   string
+		header string
+	}{
+		{target: "/fast", status: http.StatusCreated, body: "created", header: "1"},
+		{target: "/slow", status: http.StatusServiceUnavailable},
+		{target: "/param/7", status: http.StatusOK, body: "7"},
+		{target: "/longer", status: http.StatusServiceUnavailable},
+	} {
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.target, nil))
+
+		if w.Code != tc.status || w.Body.String() != tc.body || w.Header().Get("X-Plan") != tc.header {
+			t.Errorf("%s: %d %q %q, want %d %q %q", tc.target, w.Code, w.Body.String(), w.Header().Get("X-Plan"),
+				tc.status, tc.body, tc.header)
+		}
+	}
+
+	if err := <-lateWrite; !errors.Is(err, http.ErrHandlerTimeout) {
+		t.Errorf("late write error %v", err)
+	}
+}
+
+func TestTimeoutPanic(t *testing.T) {
+	h := Timeout(time.Second, nil, nil)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	}))
+
+	defer func() {
+		p, ok := recover().(*PanicError)
+		if !ok || p.Value != "boom" {
+			t.Fatalf("recovered %v", p)
+		}
+
+		// The stack is the one of the handler goroutine
+		frame, _ := runtime.CallersFrames(p.Stack).Next()
+		if !strings.Contains(frame.Function, "TestTimeoutPanic") {
+			t.Errorf("first frame %s", frame.Function)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestTimeoutLatePanic(t *testing.T) {
+	late := make(chan *PanicError, 1)
+	h := Timeout(10*time.Millisecond, nil, func(r *http.Request, p *PanicError) {
+		late <- p
+	})(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		panic("too late")
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status %d", w.Code)
+	}
+
+	select {
+	case p := <-late:
+		if p.Value != "too late" {
+			t.Errorf("late panic %v", p.Value)
+		}
+	case <-time.After(time.Second):
+		t.Error("late panic not reported")
+	}
+}